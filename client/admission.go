@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DeadlineHeader tells the replica how long the client is willing to
+	// wait for a response, in milliseconds, so it can shed requests it would
+	// answer too late
+	DeadlineHeader = "X-Prequal-Deadline"
+	// RejectedHeader marks responses of replicas shedding load
+	RejectedHeader = "X-Prequal-Rejected"
+)
+
+// DefaultRetryAfter is how long a replica that rejected a request without
+// saying for how long, e.g. without a Retry-After header, is treated as hot
+const DefaultRetryAfter = time.Second
+
+// setDeadline passes the remaining time of ctx to the replica
+func setDeadline(ctx context.Context, req *http.Request) {
+	deadline, ok := ctx.Deadline()
+	if !ok || req.Header.Get(DeadlineHeader) != "" {
+		return
+	}
+	ms := max(time.Until(deadline).Milliseconds(), 0)
+	req.Header.Set(DeadlineHeader, strconv.FormatInt(ms, 10))
+}
+
+// rejection reports whether the replica shed the request and for how long
+// it asked not to be sent more
+func rejection(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get(RejectedHeader) == "" {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return DefaultRetryAfter, true
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// markHot treats the server as hot until its Retry-After passed, whatever
+// its probes say, so the selector prefers other replicas while it sheds
+// load. Callers must hold c.mu.
+func (c *Client) markHot(server string, retryAfter time.Duration) {
+	until := time.Now().Add(retryAfter)
+	if until.After(c.hot[server]) {
+		c.hot[server] = until
+	}
+}
+
+// isHot reports whether the server recently rejected a request, forgetting
+// it once the Retry-After passed. Callers must hold c.mu.
+func (c *Client) isHot(server string, now time.Time) bool {
+	until, ok := c.hot[server]
+	if ok && !now.Before(until) {
+		delete(c.hot, server)
+		return false
+	}
+	return ok
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTransportSendsDeadline(t *testing.T) {
+	var deadline string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline = r.Header.Get(DeadlineHeader)
+	}))
+	defer backend.Close()
+
+	c := NewClient(Config{ProbeRate: 1}, []string{serverAddr(backend)}, ModeRoundRobin)
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://my-service/ping", nil)
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	ms, err := strconv.Atoi(deadline)
+	if err != nil || ms <= 0 || ms > 1000 {
+		t.Errorf("Expected a deadline of up to 1000ms, got %q", deadline)
+	}
+}
+
+func TestRejectionMarksServerHot(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.Header().Set(RejectedHeader, "overloaded")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+	rejecting := serverAddr(backend)
+
+	c := NewClient(Config{ProbeRate: 1, QRIFThreshold: 0.75}, []string{rejecting, "b"}, ModeHCL)
+	c.Stop()
+	c.probes = []ProbeInfo{
+		{ServerID: rejecting, RIF: 1, NormalizedRIF: 0.1, Latency: time.Millisecond, Timestamp: time.Now()},
+		{ServerID: "b", RIF: 5, NormalizedRIF: 0.5, Latency: time.Second, Timestamp: time.Now()},
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://"+rejecting+"/batch", nil)
+	resp, err := c.roundTrip(http.DefaultTransport, req, rejecting, "/batch")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if !c.Healthy(rejecting) {
+		t.Errorf("Expected a rejection not to count as a failure")
+	}
+	for i := 0; i < 5; i++ {
+		server, err := c.SelectReplica("/batch")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if server != "b" {
+			t.Errorf("Expected the cold server to be preferred over the rejecting one, got %s", server)
+		}
+	}
+	if c.probes[0].NormalizedRIF != 0.1 {
+		t.Errorf("Expected the client's probes to be left untouched, got %v", c.probes[0].NormalizedRIF)
+	}
+
+	// The server is cold again once its Retry-After passed
+	c.mu.Lock()
+	c.hot[rejecting] = time.Now().Add(-time.Second)
+	c.mu.Unlock()
+	if server, _ := c.SelectReplica("/batch"); server != rejecting {
+		t.Errorf("Expected %s once Retry-After passed, got %s", rejecting, server)
+	}
+}
+
+func TestRejectionRequiresHeader(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	if _, ok := rejection(resp); ok {
+		t.Errorf("Expected a plain 503 not to be a rejection")
+	}
+
+	resp.Header.Set(RejectedHeader, "deadline")
+	if retryAfter, ok := rejection(resp); !ok || retryAfter != DefaultRetryAfter {
+		t.Errorf("Expected rejection with default Retry-After, got %v %v", retryAfter, ok)
+	}
+}
@@ -2,10 +2,14 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go-prequel/metrics"
+	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"os"
 	"sync"
@@ -20,23 +24,58 @@ type ProbeInfo struct {
 	Timestamp     time.Time
 	UseCount      int     // Number of times this probe has been reused
 	NormalizedRIF float64 // Normalized RIF value for this server
+
+	// Latency estimated for each job, if the server reports it
+	JobLatencies map[string]time.Duration
+
+	Draining bool // Set if the server is shutting down and should not be selected
+}
+
+// jobPaths maps the jobs of the built-in endpoint methods to the paths the
+// server reports their latency under
+var jobPaths = map[string]string{
+	"ping":   "/ping",
+	"medium": "/medium",
+	"batch":  "/batch",
+}
+
+// JobLatency returns the latency estimated for the job, falling back to the
+// server-wide latency if the server has no estimate for it
+func (p *ProbeInfo) JobLatency(job string) time.Duration {
+	if latency, ok := p.JobLatencies[job]; ok {
+		return latency
+	}
+	if latency, ok := p.JobLatencies[jobPaths[job]]; ok {
+		return latency
+	}
+	return p.Latency
 }
 
 // Config holds client configuration
 type Config struct {
-	MaxProbePoolSize int           `json:"max_probe_pool_size"` // M in the spec (default 16)
-	NumReplicas      int           `json:"num_replicas"`        // N in the spec
-	ProbeRate        float64       `json:"probe_rate"`          // r_probe
-	QRIFThreshold    float64       `json:"q_rif_threshold"`     // Q_RIF threshold to determine hot/cold
-	DeltaReuse       float64       `json:"delta_reuse"`         // delta for b_reuse calculation
-	MaxProbeAge      time.Duration `json:"max_probe_age"`       // Maximum age of a probe before considered stale
-	MaxProbeUse      int           `json:"max_probe_use"`       // Maximum number of times a probe can be reused (calculated from bReuse)
-	Servers          []string      `json:"servers"`
+	MaxProbePoolSize   int           `json:"max_probe_pool_size"` // M in the spec (default 16)
+	NumReplicas        int           `json:"num_replicas"`        // N in the spec
+	ProbeRate          float64       `json:"probe_rate"`          // r_probe
+	QRIFThreshold      float64       `json:"q_rif_threshold"`     // Q_RIF threshold to determine hot/cold
+	DeltaReuse         float64       `json:"delta_reuse"`         // delta for b_reuse calculation
+	MaxProbeAge        time.Duration `json:"max_probe_age"`       // Maximum age of a probe before considered stale
+	MaxProbeUse        int           `json:"max_probe_use"`       // Maximum number of times a probe can be reused (calculated from bReuse)
+	ProbeSubsetSize    int           `json:"probe_subset_size"`   // d, number of random replicas probed on every tick (default 3)
+	ProbeOnQuery       bool          `json:"probe_on_query"`      // Also send r_probe probes for every query
+	ProbeTimeout       time.Duration `json:"probe_timeout"`       // Time after which a probe is abandoned (default one probe interval)
+	UnhealthyThreshold int           `json:"unhealthy_threshold"` // Consecutive probe or request failures that mark a server unhealthy (default 3)
+	HealthyThreshold   int           `json:"healthy_threshold"`   // Consecutive successful probes that bring an unhealthy server back (default 2)
+	Outlier            OutlierConfig `json:"outlier_detection"`
+	Retry              RetryPolicy   `json:"retry"`
+	Hedge              HedgePolicy   `json:"hedge"`
+	Jobs               []string      `json:"jobs"` // Request paths reported as their own job, other paths are reported as "other"
+	Servers            []string      `json:"servers"`
 }
 
 // ServerPool represents a pool of available servers
 type ServerPool struct {
 	Servers []string
+	index   map[string]int // position of each server in Servers
 	mu      sync.RWMutex
 }
 
@@ -60,51 +99,114 @@ type Client struct {
 	probeTicker *time.Ticker
 	done        chan struct{}
 
+	// Probes that take longer than this are abandoned
+	probeTimeout time.Duration
+
 	// Track maximum RIF seen across all servers
 	maxRIF uint64
 	logger *log.Logger
 
-	rrIndex int
-	mode    SelectionMode
+	selector  Selector
+	prober    Prober
+	transport *Transport
+
+	// NumReplicas follows the pool size when it is not configured
+	autoReplicas bool
+
+	// Health of servers that failed recently, and how many are unhealthy
+	health    map[string]*replicaHealth
+	unhealthy int
+
+	// Servers selection picks from when some are unhealthy, ejected or
+	// draining, rebuilt when it is stale
+	available      []string
+	availableStale bool
+
+	// Servers whose last probe announced they are shutting down
+	draining map[string]bool
+
+	// Servers that rejected a request, until their Retry-After passes
+	hot map[string]time.Time
+
+	// Outlier detection state of servers with recent requests, and how many
+	// are ejected
+	outliers      map[string]*outlierStats
+	ejected       int
+	outlierTicker *time.Ticker
+
+	retryBudget retryBudget
+	latencies   jobLatencies
+	refresh     probeRefresh
 }
 
-// NewClient creates a new client with the given configuration and server addresses
-func NewClient(config Config, servers []string, mode SelectionMode) *Client {
-	if config.MaxProbePoolSize == 0 {
-		config.MaxProbePoolSize = 16
-	}
-	if config.DeltaReuse == 0 {
-		config.DeltaReuse = 0.1
-	}
-	if config.MaxProbeAge == 0 {
-		config.MaxProbeAge = 5 * time.Second
+// Option configures optional client behaviour
+type Option func(*Client)
+
+// WithSelector makes the client use the given selector instead of the one
+// registered for the selection mode
+func WithSelector(selector Selector) Option {
+	return func(c *Client) {
+		c.selector = selector
 	}
-	config.MaxProbeUse = calculateBReuse(config)
+}
 
-	// Ensure we have at most 5 servers
-	if len(servers) > 5 {
-		servers = servers[:5]
+// NewClient creates a new client with the given configuration and server addresses
+func NewClient(config Config, servers []string, mode SelectionMode, opts ...Option) *Client {
+	setDefaults(&config)
+	servers = dedupeServers(servers)
+	autoReplicas := config.NumReplicas == 0
+	if autoReplicas {
+		config.NumReplicas = len(servers)
 	}
+	config.MaxProbeUse = calculateBReuse(config)
+	// Membership lives in the pool, see Config
+	config.Servers = nil
 
 	c := &Client{
 		config: config,
 		probes: make([]ProbeInfo, 0, config.MaxProbePoolSize),
 		pool: ServerPool{
 			Servers: servers,
+			index:   indexServers(servers),
 		},
-		done:    make(chan struct{}),
-		maxRIF:  0, // Initialize maxRIF
-		mode:    mode,
-		rrIndex: 0,
+		done:         make(chan struct{}),
+		maxRIF:       0, // Initialize maxRIF
+		autoReplicas: autoReplicas,
+		health:       make(map[string]*replicaHealth),
+		draining:     make(map[string]bool),
+		hot:          make(map[string]time.Time),
+		outliers:     make(map[string]*outlierStats),
+	}
+	c.retryBudget.tokens = float64(config.Retry.BudgetBurst)
+	metrics.UpdateServerPoolSize(len(servers))
+	c.logger = log.New(os.Stdout, "[Client] ", log.LstdFlags)
+
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.transport = NewTransport(c)
+	if c.prober == nil {
+		c.prober = NewHTTPProber()
+	}
+	if c.selector == nil {
+		selector, err := NewSelector(mode)
+		if err != nil {
+			c.logger.Printf("%v, falling back to %s", err, ModeHCL)
+			selector = &HCLSelector{}
+		}
+		c.selector = selector
 	}
 
 	// Start probe ticker based on probe rate
-	interval := time.Duration(float64(time.Second) / config.ProbeRate)
+	interval := probeInterval(config)
 	c.probeTicker = time.NewTicker(interval)
-	c.logger = log.New(os.Stdout, "[Client] ", log.LstdFlags)
+	c.probeTimeout = probeTimeout(config)
 	c.logger.Printf("Starting client with %d servers", len(c.pool.Servers))
 	c.logger.Printf("Config: %+v", config)
 	go c.probeLoop()
+
+	c.outlierTicker = time.NewTicker(config.Outlier.Interval)
+	go c.outlierLoop()
 	return c
 }
 
@@ -133,84 +235,40 @@ func (c *Client) isProbeHot(probe ProbeInfo) bool {
 	return probe.NormalizedRIF >= c.config.QRIFThreshold
 }
 
+// SelectReplica picks a replica for the job using the client's selector
 func (c *Client) SelectReplica(job string) (string, error) {
-	switch c.mode {
-	case ModeRoundRobin:
-		return c.selectReplicaRoundRobin(job)
-	default:
-		return c.selectReplicaHCL(job)
-	}
-}
-
-func (c *Client) selectReplicaRoundRobin(job string) (string, error) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if len(c.pool.Servers) == 0 {
-		return "", fmt.Errorf("no servers available")
-	}
-
-	server := c.pool.Servers[c.rrIndex]
-	c.rrIndex = (c.rrIndex + 1) % len(c.pool.Servers)
-
-	// Record metrics
-	metrics.IncrementServerChosen(server, job)
-	metrics.IncrementProbeSelection("round_robin", server)
-
-	c.logger.Printf("Round-robin selected server: %s", server)
-	return server, nil
+	return c.selectReplica(job, nil)
 }
 
-func (c *Client) selectReplicaHCL(job string) (string, error) {
+// selectReplica picks a replica, leaving out the excluded ones unless no
+// other replica is left
+func (c *Client) selectReplica(job string, excluded map[string]bool) (string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if len(c.probes) == 0 {
-		return "", fmt.Errorf("no probes available")
-	}
-
-	// Find if we have any cold replicas
-	var coldProbes, hotProbes []ProbeInfo
-	for i := range c.probes {
-		if c.isProbeHot(c.probes[i]) {
-			hotProbes = append(hotProbes, c.probes[i])
-		} else {
-			coldProbes = append(coldProbes, c.probes[i])
-		}
-	}
-
-	// Select probe and increment its use count
-	var selected *ProbeInfo
-	if len(coldProbes) > 0 {
-		selected = &coldProbes[0]
-		for i := range coldProbes {
-			if coldProbes[i].RIF < selected.RIF {
-				selected = &coldProbes[i]
-			}
-		}
-		metrics.IncrementProbeSelection("cold", selected.ServerID)
-	} else {
-		selected = &hotProbes[0]
-		for i := range hotProbes {
-			if hotProbes[i].Latency < selected.Latency {
-				selected = &hotProbes[i]
-			}
-		}
-		metrics.IncrementProbeSelection("hot", selected.ServerID)
+	c.pool.mu.RLock()
+	server, err := c.selector.Select(c.selectionPool(excluded), job)
+	c.pool.mu.RUnlock()
+	if err != nil {
+		return "", err
 	}
 
-	// Find and increment the use count of the selected probe
+	// Charge the selection against a probe for the chosen server
 	for i := range c.probes {
-		if c.probes[i].ServerID == selected.ServerID {
+		if c.probes[i].ServerID == server {
 			c.probes[i].UseCount++
-			metrics.IncrementProbeReuse(selected.ServerID)
+			metrics.IncrementProbeReuse(server)
 			break
 		}
 	}
 
-	metrics.IncrementServerChosen(selected.ServerID, job)
+	metrics.IncrementServerChosen(server, job)
 
-	return selected.ServerID, nil
+	if c.config.ProbeOnQuery {
+		c.probeOnQuery()
+	}
+
+	return server, nil
 }
 
 // probeLoop continuously probes servers at the configured rate
@@ -229,25 +287,87 @@ func (c *Client) probeLoop() {
 func (c *Client) Stop() {
 	close(c.done)
 	c.probeTicker.Stop()
+	c.outlierTicker.Stop()
 }
 
-// Probe implements the probing logic
+// Probe implements the probing logic, probing a random subset of d replicas
 func (c *Client) Probe() {
+	c.mu.RLock()
+	d := c.config.ProbeSubsetSize
+	c.mu.RUnlock()
+	c.probeRandom(context.Background(), d)
+}
+
+// probeRandom probes d replicas sampled uniformly without replacement.
+// Probes are sent concurrently without holding the client lock, so
+// selection never waits on probe round-trips; results are merged into the
+// pool under a short critical section. Each probe is bounded by both ctx
+// and the probe timeout.
+func (c *Client) probeRandom(ctx context.Context, d int) {
+	c.mu.RLock()
+	timeout := c.probeTimeout
+	c.mu.RUnlock()
+
+	c.pool.mu.RLock()
+	servers := sampleServers(c.pool.Servers, d)
+	c.pool.mu.RUnlock()
+
+	results := make([]*ProbeInfo, len(servers))
+	failures := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			probeInfo, err := c.probeServer(ctx, server)
+			if err != nil {
+				failures[i] = err
+				return
+			}
+			results[i] = probeInfo
+		}(i, server)
+	}
+	wg.Wait()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.removeStaleAndOverusedProbes()
+	// Drop results for servers removed while the probe was in flight
+	c.pool.mu.RLock()
+	for i, server := range servers {
+		if !c.pool.contains(server) {
+			results[i], failures[i] = nil, nil
+		}
+	}
+	c.pool.mu.RUnlock()
 
-	if len(c.probes) >= c.config.MaxProbePoolSize {
-		c.removeProbe()
+	// Failures are only the replica's fault if the caller did not give up
+	if ctx.Err() == nil {
+		for i, err := range failures {
+			if err != nil {
+				c.probeFailed(servers[i], err)
+			}
+		}
 	}
 
-	// Probe all servers in the pool
-	c.pool.mu.RLock()
-	newProbes := make([]ProbeInfo, 0, len(c.pool.Servers))
-	for _, server := range c.pool.Servers {
-		probeInfo, err := c.ProbeServer(server)
-		if err != nil {
+	for i, probeInfo := range results {
+		if probeInfo == nil {
+			continue
+		}
+		c.recordSuccess(probeInfo.ServerID, true)
+		c.recordDraining(probeInfo)
+		if c.leftOut(probeInfo.ServerID) {
+			results[i] = nil
+		}
+	}
+
+	c.removeStaleAndOverusedProbes()
+
+	for _, probeInfo := range results {
+		if probeInfo == nil {
 			continue
 		}
 
@@ -256,18 +376,62 @@ func (c *Client) Probe() {
 			c.maxRIF = probeInfo.RIF
 			metrics.UpdateMaxRIF(c.maxRIF)
 		}
+	}
+
+	// Update normalized RIF for all new probes and add them to the pool,
+	// evicting a probe whenever the pool is full
+	for _, probeInfo := range results {
+		if probeInfo == nil {
+			continue
+		}
+		c.updateRIFDistribution(probeInfo)
+		metrics.UpdateNormalizedRIF(probeInfo.ServerID, probeInfo.NormalizedRIF)
 
-		newProbes = append(newProbes, *probeInfo)
+		if len(c.probes) >= c.config.MaxProbePoolSize {
+			c.removeProbe()
+		}
+		c.probes = append(c.probes, *probeInfo)
 	}
+}
 
-	// Update normalized RIF for all existing probes
-	for i := range newProbes {
-		c.updateRIFDistribution(&newProbes[i])
-		metrics.UpdateNormalizedRIF(newProbes[i].ServerID, newProbes[i].NormalizedRIF)
+// probeOnQuery issues r_probe probes for a query in the background. A
+// fractional probe rate is honoured probabilistically, so a rate of 1.5
+// sends one probe and a second one half of the time.
+func (c *Client) probeOnQuery() {
+	d := int(c.config.ProbeRate)
+	if rand.Float64() < c.config.ProbeRate-float64(d) {
+		d++
+	}
+	if d > 0 {
+		go c.probeRandom(context.Background(), d)
 	}
-	// append new probes to the existing probes
-	c.probes = append(c.probes, newProbes...)
-	c.pool.mu.RUnlock()
+}
+
+// sampleServers returns up to d servers chosen uniformly at random. It runs
+// a partial Fisher-Yates shuffle that tracks only the swapped positions, so
+// the cost is O(d) regardless of the pool size.
+func sampleServers(servers []string, d int) []string {
+	if d >= len(servers) {
+		return append([]string(nil), servers...)
+	}
+
+	sampled := make([]string, d)
+	swapped := make(map[int]int, d)
+	for i := 0; i < d; i++ {
+		j := i + rand.Intn(len(servers)-i)
+
+		picked, ok := swapped[j]
+		if !ok {
+			picked = j
+		}
+		current, ok := swapped[i]
+		if !ok {
+			current = i
+		}
+		swapped[j] = current
+		sampled[i] = servers[picked]
+	}
+	return sampled
 }
 
 // removeStaleAndOverusedProbes removes probes that are too old or have been used too many times
@@ -292,50 +456,34 @@ func (c *Client) removeStaleAndOverusedProbes() {
 	c.probes = fresh
 }
 
-// removeProbe implements the probe removal strategy
+// removeProbe implements the probe removal strategy: the hot probe with the
+// highest RIF goes first, otherwise the cold probe with the highest latency
 func (c *Client) removeProbe() {
 	if len(c.probes) == 0 {
 		return
 	}
 
-	// Find hot probes
-	var hotProbes []ProbeInfo
-	for _, probe := range c.probes {
+	maxRIFIndex, maxLatencyIndex := -1, 0
+	for i, probe := range c.probes {
 		if c.isProbeHot(probe) {
-			hotProbes = append(hotProbes, probe)
-		}
-	}
-
-	// If we have hot probes, remove the one with highest RIF
-	if len(hotProbes) > 0 {
-		maxRIFIndex := 0
-		for i, probe := range hotProbes {
-			if probe.RIF > hotProbes[maxRIFIndex].RIF {
+			if maxRIFIndex < 0 || probe.RIF > c.probes[maxRIFIndex].RIF {
 				maxRIFIndex = i
 			}
+		} else if probe.Latency > c.probes[maxLatencyIndex].Latency {
+			maxLatencyIndex = i
 		}
-		c.removeProbeByServerID(hotProbes[maxRIFIndex].ServerID)
-		return
 	}
 
-	// If all probes are cold, remove the one with highest latency
-	maxLatencyIndex := 0
-	for i, probe := range c.probes {
-		if probe.Latency > c.probes[maxLatencyIndex].Latency {
-			maxLatencyIndex = i
-		}
+	if maxRIFIndex >= 0 {
+		c.removeProbeAt(maxRIFIndex)
+		return
 	}
-	c.removeProbeByServerID(c.probes[maxLatencyIndex].ServerID)
+	c.removeProbeAt(maxLatencyIndex)
 }
 
-// removeProbeByServerID removes a probe with the given server ID
-func (c *Client) removeProbeByServerID(serverID string) {
-	for i, probe := range c.probes {
-		if probe.ServerID == serverID {
-			c.probes = append(c.probes[:i], c.probes[i+1:]...)
-			return
-		}
-	}
+// removeProbeAt removes the probe at index i
+func (c *Client) removeProbeAt(i int) {
+	c.probes = append(c.probes[:i], c.probes[i+1:]...)
 }
 
 type ServerResponse struct {
@@ -345,35 +493,33 @@ type ServerResponse struct {
 
 // ProbeServer probes a server and returns its RIF
 func (c *Client) ProbeServer(serverAddr string) (*ProbeInfo, error) {
-	resp, err := http.Get(fmt.Sprintf("http://%s/probe", serverAddr))
-	if err != nil {
-		return nil, fmt.Errorf("probe failed: %w", err)
-	}
-	defer resp.Body.Close()
+	return c.ProbeServerContext(context.Background(), serverAddr)
+}
 
-	var probeResp struct {
-		RIF     uint64        `json:"rif"`
-		Latency time.Duration `json:"latency"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&probeResp); err != nil {
-		return nil, fmt.Errorf("decode failed: %w", err)
-	}
+// ProbeServerContext probes a server, giving up when ctx is done or the
+// probe timeout expires
+func (c *Client) ProbeServerContext(ctx context.Context, serverAddr string) (*ProbeInfo, error) {
+	c.mu.RLock()
+	timeout := c.probeTimeout
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return c.probeServer(ctx, serverAddr)
+}
 
-	return &ProbeInfo{
-		RIF:       probeResp.RIF,
-		Latency:   probeResp.Latency,
-		ServerID:  serverAddr,
-		Timestamp: time.Now(),
-		UseCount:  0,
-	}, nil
+func (c *Client) probeServer(ctx context.Context, serverAddr string) (*ProbeInfo, error) {
+	return c.prober.Probe(ctx, serverAddr)
 }
 
 // BatchProcess sends a batch processing request
 func (c *Client) BatchProcess(strings []string) error {
-	serverAddr, err := c.SelectReplica("batch")
-	if err != nil {
-		return fmt.Errorf("no replica available: %w", err)
-	}
+	return c.BatchProcessContext(context.Background(), strings)
+}
+
+// BatchProcessContext sends a batch processing request that is abandoned
+// when ctx is done
+func (c *Client) BatchProcessContext(ctx context.Context, strings []string) error {
 	reqBody, err := json.Marshal(map[string][]string{
 		"strings": strings,
 	})
@@ -381,49 +527,61 @@ func (c *Client) BatchProcess(strings []string) error {
 		return fmt.Errorf("marshal failed: %w", err)
 	}
 
-	resp, err := http.Post(fmt.Sprintf("http://%s/batch", serverAddr), "application/json", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/batch", bytes.NewReader(reqBody))
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server error: %s", resp.Status)
-	}
+	req.Header.Set("Content-Type", "application/json")
 
-	return nil
+	resp, err := c.do(ctx, "batch", req)
+	return checkResponse("request", resp, err)
 }
 
 // Ping sends a ping request
 func (c *Client) Ping() error {
-	serverAddr, err := c.SelectReplica("ping")
-	if err != nil {
-		return fmt.Errorf("no replica available: %w", err)
-	}
-	resp, err := http.Get(fmt.Sprintf("http://%s/ping", serverAddr))
+	return c.PingContext(context.Background())
+}
+
+// PingContext sends a ping request that is abandoned when ctx is done
+func (c *Client) PingContext(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/ping", nil)
 	if err != nil {
 		return fmt.Errorf("ping failed: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server error: %s", resp.Status)
-	}
 
-	return nil
+	resp, err := c.do(ctx, "ping", req)
+	return checkResponse("ping", resp, err)
 }
 
 // MediumProcess sends a medium processing request
 func (c *Client) MediumProcess() error {
-	serverAddr, err := c.SelectReplica("medium")
+	return c.MediumProcessContext(context.Background())
+}
+
+// MediumProcessContext sends a medium processing request that is abandoned
+// when ctx is done
+func (c *Client) MediumProcessContext(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/medium", nil)
 	if err != nil {
-		return fmt.Errorf("no replica available: %w", err)
+		return fmt.Errorf("request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(ctx, "medium", req)
+	return checkResponse("request", resp, err)
+}
+
+// checkResponse drains and closes the response, turning a non-200 status
+// into an error. Errors of the request are reported as "<op> failed".
+func checkResponse(op string, resp *http.Response, err error) error {
+	if errors.Is(err, ErrNoReplica) {
+		return err
 	}
-	resp, err := http.Post(fmt.Sprintf("http://%s/medium", serverAddr), "application/json", nil)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return fmt.Errorf("%s failed: %w", op, err)
 	}
 	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("server error: %s", resp.Status)
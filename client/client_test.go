@@ -0,0 +1,270 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newProbeServer starts a replica whose probe handler answers after delay
+func newProbeServer(t testing.TB, rif uint64, delay time.Duration) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rif":     rif,
+			"latency": time.Millisecond,
+		})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func serverAddr(s *httptest.Server) string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func newTestClient(t testing.TB, servers []string) *Client {
+	t.Helper()
+	c := NewClient(Config{
+		NumReplicas:   len(servers),
+		ProbeRate:     1,
+		QRIFThreshold: 0.75,
+	}, servers, ModeHCL)
+	t.Cleanup(c.Stop)
+	return c
+}
+
+func TestSampleServers(t *testing.T) {
+	servers := make([]string, 10)
+	for i := range servers {
+		servers[i] = fmt.Sprintf("server-%d", i)
+	}
+
+	for _, d := range []int{0, 3, 10, 20} {
+		t.Run(fmt.Sprintf("Sampling %d servers", d), func(t *testing.T) {
+			sampled := sampleServers(servers, d)
+
+			expected := min(d, len(servers))
+			if len(sampled) != expected {
+				t.Fatalf("Expected %d servers, got %d", expected, len(sampled))
+			}
+
+			seen := make(map[string]bool)
+			for _, server := range sampled {
+				if seen[server] {
+					t.Errorf("Server %s sampled twice", server)
+				}
+				seen[server] = true
+			}
+		})
+	}
+}
+
+func TestProbeDoesNotBlockSelection(t *testing.T) {
+	slow := newProbeServer(t, 1, 500*time.Millisecond)
+	c := newTestClient(t, []string{serverAddr(slow)})
+	c.probes = append(c.probes, ProbeInfo{ServerID: serverAddr(slow), Timestamp: time.Now()})
+
+	go c.probeRandom(context.Background(), 1)
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := c.SelectReplica("ping"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Selection blocked behind probe for %v", elapsed)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	hung := newProbeServer(t, 1, time.Second)
+	c := NewClient(Config{
+		ProbeRate:     1,
+		QRIFThreshold: 0.75,
+		ProbeTimeout:  50 * time.Millisecond,
+	}, []string{serverAddr(hung)}, ModeHCL)
+	t.Cleanup(c.Stop)
+	c.probes = append(c.probes, ProbeInfo{ServerID: serverAddr(hung), Timestamp: time.Now()})
+
+	start := time.Now()
+	c.probeRandom(context.Background(), 1)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Probe was not abandoned after the timeout, took %v", elapsed)
+	}
+
+	// The failed probe is a signal that the old load reading can't be trusted
+	if len(c.probes) != 0 {
+		t.Errorf("Expected probes of the hung server to be purged, got %d", len(c.probes))
+	}
+}
+
+func TestHTTPProberRejectsErrorStatus(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(s.Close)
+
+	if _, err := NewHTTPProber().Probe(context.Background(), serverAddr(s)); err == nil {
+		t.Error("Expected an error for a non-200 probe response")
+	}
+}
+
+// BenchmarkSelectReplica measures selection while probes with increasing
+// latency are continuously in flight
+func BenchmarkSelectReplica(b *testing.B) {
+	for _, delay := range []time.Duration{0, 10 * time.Millisecond, 100 * time.Millisecond} {
+		b.Run(fmt.Sprintf("probe_latency=%v", delay), func(b *testing.B) {
+			servers := make([]string, 5)
+			for i := range servers {
+				servers[i] = serverAddr(newProbeServer(b, uint64(i), delay))
+			}
+			c := newTestClient(b, servers)
+			c.config.MaxProbeUse = b.N + 1
+			for _, server := range servers {
+				c.probes = append(c.probes, ProbeInfo{ServerID: server, Timestamp: time.Now()})
+			}
+
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						c.probeRandom(context.Background(), len(servers))
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.SelectReplica("ping"); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveProbe(t *testing.T) {
+	c := &Client{config: Config{QRIFThreshold: 0.75}}
+
+	// Duplicate server IDs must not cause a different probe to be evicted
+	c.probes = []ProbeInfo{
+		{ServerID: "a", RIF: 1, NormalizedRIF: 0.1, Latency: time.Second},
+		{ServerID: "a", RIF: 9, NormalizedRIF: 0.9},
+		{ServerID: "b", RIF: 8, NormalizedRIF: 0.8},
+	}
+	c.removeProbe()
+	if len(c.probes) != 2 || c.probes[0].RIF != 1 || c.probes[1].RIF != 8 {
+		t.Errorf("Expected hottest probe to be removed, got %+v", c.probes)
+	}
+
+	c.probes = []ProbeInfo{
+		{ServerID: "a", Latency: time.Millisecond},
+		{ServerID: "a", Latency: time.Second},
+	}
+	c.removeProbe()
+	if len(c.probes) != 1 || c.probes[0].Latency != time.Millisecond {
+		t.Errorf("Expected slowest cold probe to be removed, got %+v", c.probes)
+	}
+}
+
+// newLargePoolClient builds a client over n replicas with m probes and no
+// background probing
+func newLargePoolClient(b *testing.B, mode SelectionMode, n, m int) *Client {
+	servers := make([]string, n)
+	for i := range servers {
+		servers[i] = fmt.Sprintf("10.0.%d.%d:8080", i/256, i%256)
+	}
+	c := NewClient(Config{
+		MaxProbePoolSize: m,
+		ProbeRate:        1,
+		QRIFThreshold:    0.75,
+	}, servers, mode)
+	c.Stop()
+	c.config.MaxProbeUse = b.N + 1
+
+	for _, server := range sampleServers(servers, m) {
+		rif := uint64(rand.Intn(100))
+		c.probes = append(c.probes, ProbeInfo{
+			ServerID:      server,
+			RIF:           rif,
+			NormalizedRIF: float64(rif) / 100,
+			Latency:       time.Duration(rand.Intn(1000)) * time.Millisecond,
+			Timestamp:     time.Now(),
+		})
+	}
+	return c
+}
+
+func BenchmarkSelectReplicaLargePool(b *testing.B) {
+	for _, mode := range []SelectionMode{ModeHCL, ModeRoundRobin} {
+		for _, m := range []int{16, 1000} {
+			b.Run(fmt.Sprintf("%s/N=1000/M=%d", mode, m), func(b *testing.B) {
+				c := newLargePoolClient(b, mode, 1000, m)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := c.SelectReplica("ping"); err != nil {
+						b.Fatalf("Unexpected error: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkSelectReplicaLargePoolUnhealthy(b *testing.B) {
+	for _, mode := range []SelectionMode{ModeHCL, ModeRoundRobin} {
+		b.Run(fmt.Sprintf("%s/N=1000/M=16", mode), func(b *testing.B) {
+			c := newLargePoolClient(b, mode, 1000, 16)
+			c.mu.Lock()
+			for i := 0; i < c.config.UnhealthyThreshold; i++ {
+				c.recordFailure(c.pool.Servers[0])
+			}
+			c.mu.Unlock()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.SelectReplica("ping"); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRemoveProbeLargePool(b *testing.B) {
+	c := newLargePoolClient(b, ModeHCL, 1000, 1000)
+	probes := append([]ProbeInfo(nil), c.probes...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.removeProbe()
+		if len(c.probes) == 0 {
+			c.probes = append(c.probes, probes...)
+		}
+	}
+}
+
+func BenchmarkSampleServers(b *testing.B) {
+	servers := make([]string, 1000)
+	for i := range servers {
+		servers[i] = fmt.Sprintf("server-%d", i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sampleServers(servers, 3)
+	}
+}
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// setDefaults fills in unset tunables
+func setDefaults(config *Config) {
+	if config.MaxProbePoolSize == 0 {
+		config.MaxProbePoolSize = 16
+	}
+	if config.DeltaReuse == 0 {
+		config.DeltaReuse = 0.1
+	}
+	if config.MaxProbeAge == 0 {
+		config.MaxProbeAge = 5 * time.Second
+	}
+	if config.ProbeSubsetSize == 0 {
+		config.ProbeSubsetSize = 3
+	}
+	if config.UnhealthyThreshold == 0 {
+		config.UnhealthyThreshold = 3
+	}
+	if config.HealthyThreshold == 0 {
+		config.HealthyThreshold = 2
+	}
+	setOutlierDefaults(&config.Outlier)
+	if config.Retry.BudgetRatio == 0 {
+		config.Retry.BudgetRatio = 0.1
+	}
+	if config.Retry.BudgetBurst == 0 {
+		config.Retry.BudgetBurst = 10
+	}
+}
+
+// setOutlierDefaults fills in unset outlier detection tunables. A zero
+// MaxEjectionPercent disables ejection, so only a missing one defaults.
+func setOutlierDefaults(config *OutlierConfig) {
+	if config.MaxEjectionPercent == nil {
+		percent := 10
+		config.MaxEjectionPercent = &percent
+	}
+	if config.Consecutive5xx == 0 {
+		config.Consecutive5xx = 5
+	}
+	if config.Interval == 0 {
+		config.Interval = 10 * time.Second
+	}
+	if config.BaseEjectionTime == 0 {
+		config.BaseEjectionTime = 30 * time.Second
+	}
+	if config.MaxEjectionTime == 0 {
+		config.MaxEjectionTime = 300 * time.Second
+	}
+	if config.SuccessRateMinHosts == 0 {
+		config.SuccessRateMinHosts = 5
+	}
+	if config.SuccessRateRequestVolume == 0 {
+		config.SuccessRateRequestVolume = 100
+	}
+	if config.SuccessRateStdevFactor == 0 {
+		config.SuccessRateStdevFactor = 1.9
+	}
+}
+
+// probeInterval returns the time between probe ticks
+func probeInterval(config Config) time.Duration {
+	return time.Duration(float64(time.Second) / config.ProbeRate)
+}
+
+// probeTimeout returns the time after which a probe is abandoned
+func probeTimeout(config Config) time.Duration {
+	if config.ProbeTimeout > 0 {
+		return config.ProbeTimeout
+	}
+	return probeInterval(config)
+}
+
+// Validate checks that the configuration can be applied to a client
+func (config Config) Validate() error {
+	if config.ProbeRate <= 0 {
+		return fmt.Errorf("probe_rate must be positive, got %v", config.ProbeRate)
+	}
+	if config.QRIFThreshold < 0 || config.QRIFThreshold > 1 {
+		return fmt.Errorf("q_rif_threshold must be within [0, 1], got %v", config.QRIFThreshold)
+	}
+	if config.MaxProbePoolSize < 0 {
+		return fmt.Errorf("max_probe_pool_size must not be negative, got %d", config.MaxProbePoolSize)
+	}
+	if config.NumReplicas < 0 {
+		return fmt.Errorf("num_replicas must not be negative, got %d", config.NumReplicas)
+	}
+	if config.DeltaReuse < 0 {
+		return fmt.Errorf("delta_reuse must not be negative, got %v", config.DeltaReuse)
+	}
+	if config.MaxProbeAge < 0 {
+		return fmt.Errorf("max_probe_age must not be negative, got %v", config.MaxProbeAge)
+	}
+	if config.ProbeTimeout < 0 {
+		return fmt.Errorf("probe_timeout must not be negative, got %v", config.ProbeTimeout)
+	}
+	if config.ProbeSubsetSize < 0 {
+		return fmt.Errorf("probe_subset_size must not be negative, got %d", config.ProbeSubsetSize)
+	}
+	if config.UnhealthyThreshold < 0 {
+		return fmt.Errorf("unhealthy_threshold must not be negative, got %d", config.UnhealthyThreshold)
+	}
+	if config.HealthyThreshold < 0 {
+		return fmt.Errorf("healthy_threshold must not be negative, got %d", config.HealthyThreshold)
+	}
+	if err := config.Outlier.Validate(); err != nil {
+		return fmt.Errorf("outlier_detection: %w", err)
+	}
+	if err := config.Retry.Validate(); err != nil {
+		return fmt.Errorf("retry: %w", err)
+	}
+	if err := config.Hedge.Validate(); err != nil {
+		return fmt.Errorf("hedge: %w", err)
+	}
+	return nil
+}
+
+// Validate checks that the hedge policy is usable
+func (policy HedgePolicy) Validate() error {
+	if policy.Delay < 0 {
+		return fmt.Errorf("delay must not be negative, got %v", policy.Delay)
+	}
+	if policy.Percentile < 0 || policy.Percentile >= 1 {
+		return fmt.Errorf("percentile must be within [0, 1), got %v", policy.Percentile)
+	}
+	return nil
+}
+
+// Validate checks that the retry policy is usable
+func (policy RetryPolicy) Validate() error {
+	if policy.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts must not be negative, got %d", policy.MaxAttempts)
+	}
+	if policy.BudgetRatio < 0 {
+		return fmt.Errorf("budget_ratio must not be negative, got %v", policy.BudgetRatio)
+	}
+	if policy.BudgetBurst < 0 {
+		return fmt.Errorf("budget_burst must not be negative, got %d", policy.BudgetBurst)
+	}
+	return nil
+}
+
+// Validate checks that the outlier detection tunables are usable
+func (config OutlierConfig) Validate() error {
+	if config.Consecutive5xx < 0 {
+		return fmt.Errorf("consecutive_5xx must not be negative, got %d", config.Consecutive5xx)
+	}
+	if config.Interval < 0 {
+		return fmt.Errorf("interval must not be negative, got %v", config.Interval)
+	}
+	if config.BaseEjectionTime < 0 {
+		return fmt.Errorf("base_ejection_time must not be negative, got %v", config.BaseEjectionTime)
+	}
+	if config.MaxEjectionTime < 0 {
+		return fmt.Errorf("max_ejection_time must not be negative, got %v", config.MaxEjectionTime)
+	}
+	if percent := config.MaxEjectionPercent; percent != nil && (*percent < 0 || *percent > 100) {
+		return fmt.Errorf("max_ejection_percent must be within [0, 100], got %d", *percent)
+	}
+	if config.SuccessRateMinHosts < 0 {
+		return fmt.Errorf("success_rate_minimum_hosts must not be negative, got %d", config.SuccessRateMinHosts)
+	}
+	if config.SuccessRateRequestVolume < 0 {
+		return fmt.Errorf("success_rate_request_volume must not be negative, got %d", config.SuccessRateRequestVolume)
+	}
+	if config.SuccessRateStdevFactor < 0 {
+		return fmt.Errorf("success_rate_stdev_factor must not be negative, got %v", config.SuccessRateStdevFactor)
+	}
+	return nil
+}
+
+// Config returns a copy of the client's current configuration, with
+// Servers reflecting the current server pool
+func (c *Client) Config() Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	config := c.config
+	config.Servers = c.Servers()
+	return config
+}
+
+// UpdateConfig applies new tunables to a running client. The server list in
+// config is ignored; use SetServers to change membership. An invalid config
+// is rejected and leaves the client untouched.
+func (c *Client) UpdateConfig(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	setDefaults(&config)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.autoReplicas = config.NumReplicas == 0
+	if c.autoReplicas {
+		c.pool.mu.RLock()
+		config.NumReplicas = len(c.pool.Servers)
+		c.pool.mu.RUnlock()
+	}
+	config.MaxProbeUse = calculateBReuse(config)
+
+	if config.ProbeRate != c.config.ProbeRate {
+		c.probeTicker.Reset(probeInterval(config))
+	}
+	if config.Outlier.Interval != c.config.Outlier.Interval {
+		c.outlierTicker.Reset(config.Outlier.Interval)
+	}
+	c.probeTimeout = probeTimeout(config)
+	// Membership lives in the pool, so c.config never holds a server list
+	config.Servers = nil
+	c.config = config
+
+	// Shrink the probe pool if its size was lowered
+	for len(c.probes) > c.config.MaxProbePoolSize {
+		c.removeProbe()
+	}
+
+	c.logger.Printf("Config updated: %+v", config)
+	return nil
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SelectReplicaContext picks a replica like SelectReplica but honours ctx.
+// It fails once ctx is done, and when there is nothing to select from yet
+// it probes replicas right away, bounded by ctx, and tries again.
+func (c *Client) SelectReplicaContext(ctx context.Context, job string) (string, error) {
+	return c.selectReplicaContext(ctx, job, nil)
+}
+
+// selectReplicaContext is SelectReplicaContext avoiding the excluded
+// replicas, as long as there are others to choose from
+func (c *Client) selectReplicaContext(ctx context.Context, job string, excluded map[string]bool) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	server, err := c.selectReplica(job, excluded)
+	if err == nil {
+		return server, nil
+	}
+
+	if err := c.refreshProbes(ctx); err != nil {
+		return "", err
+	}
+	return c.selectReplica(job, excluded)
+}
+
+// probeRefresh coalesces the probes sent when selection has nothing to
+// select from, so their traffic does not grow with the request rate
+type probeRefresh struct {
+	done chan struct{} // Closed once the refresh in flight finished
+	last time.Time     // Start of the last refresh
+	mu   sync.Mutex
+}
+
+// refreshProbes probes replicas for a selection that found nothing to
+// select from and waits for the result or for ctx to be done. Concurrent
+// callers share one refresh, and a new one starts at most once per probe
+// interval; callers in between return right away.
+func (c *Client) refreshProbes(ctx context.Context) error {
+	c.mu.RLock()
+	d, interval := c.config.ProbeSubsetSize, probeInterval(c.config)
+	c.mu.RUnlock()
+
+	r := &c.refresh
+	r.mu.Lock()
+	done := r.done
+	if done == nil && time.Since(r.last) >= interval {
+		done = make(chan struct{})
+		r.done, r.last = done, time.Now()
+		// Not bound to ctx, as other callers may be waiting for the probes
+		go func() {
+			c.probeRandom(context.Background(), d)
+			r.mu.Lock()
+			r.done = nil
+			r.mu.Unlock()
+			close(done)
+		}()
+	}
+	r.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseReplica gives back the probe use charged by SelectReplica for a
+// request that was never sent to the server
+func (c *Client) releaseReplica(server string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.probes {
+		if c.probes[i].ServerID == server && c.probes[i].UseCount > 0 {
+			c.probes[i].UseCount--
+			return
+		}
+	}
+}
+
+// roundTrip sends a request to a selected replica with the given transport
+// and reports its outcome. A request whose context is done before it is
+// sent releases its probe use instead.
+func (c *Client) roundTrip(transport http.RoundTripper, req *http.Request, server, job string) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		c.releaseReplica(server)
+		closeBody(req)
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	outcome := Outcome{
+		Server:  server,
+		Job:     job,
+		Err:     err,
+		Latency: time.Since(start),
+	}
+	if resp != nil {
+		outcome.StatusCode = resp.StatusCode
+		outcome.RetryAfter, outcome.Rejected = rejection(resp)
+	}
+	c.ReportOutcome(outcome)
+
+	return resp, err
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSelectReplicaContextProbesEmptyPool(t *testing.T) {
+	replica := newProbeServer(t, 1, 0)
+	c := newTestClient(t, []string{serverAddr(replica)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	server, err := c.SelectReplicaContext(ctx, "ping")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if server != serverAddr(replica) {
+		t.Errorf("Expected %v, got %v", serverAddr(replica), server)
+	}
+}
+
+func TestCancelledRequestReleasesProbe(t *testing.T) {
+	c := newTestClient(t, []string{"localhost:1"})
+	c.probes = []ProbeInfo{{ServerID: "localhost:1", Timestamp: time.Now()}}
+
+	server, err := c.SelectReplica("ping")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c.probes[0].UseCount != 1 {
+		t.Fatalf("Expected probe to be charged, got use count %d", c.probes[0].UseCount)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+server+"/ping", nil)
+	if _, err := c.roundTrip(http.DefaultTransport, req, server, "ping"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if c.probes[0].UseCount != 0 {
+		t.Errorf("Expected probe use to be released, got use count %d", c.probes[0].UseCount)
+	}
+}
+
+func TestDeadlineAbandonsRequest(t *testing.T) {
+	release := make(chan struct{})
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer replica.Close()
+	defer close(release)
+
+	c := NewClient(Config{ProbeRate: 1}, []string{serverAddr(replica)}, ModeRoundRobin)
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.BatchProcessContext(ctx, []string{"example"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Request was not abandoned at the deadline, took %v", elapsed)
+	}
+}
+
+// countingProber fails every probe after a delay and counts them
+type countingProber struct {
+	probes atomic.Int32
+}
+
+func (p *countingProber) Probe(ctx context.Context, server string) (*ProbeInfo, error) {
+	p.probes.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	return nil, errors.New("connection refused")
+}
+
+func TestEmptyPoolProbesCoalesced(t *testing.T) {
+	prober := &countingProber{}
+	c := NewClient(Config{ProbeRate: 1, ProbeSubsetSize: 2}, []string{"a", "b", "c"}, ModeHCL, WithProber(prober))
+	c.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.SelectReplicaContext(context.Background(), "ping"); err == nil {
+				t.Errorf("Expected selection to fail without probes")
+			}
+		}()
+	}
+	wg.Wait()
+	if probes := prober.probes.Load(); probes != 2 {
+		t.Errorf("Expected the selections to share one probe of 2 replicas, got %d probes", probes)
+	}
+
+	// A failing selection right after does not probe again
+	start := time.Now()
+	if _, err := c.SelectReplicaContext(context.Background(), "ping"); err == nil {
+		t.Errorf("Expected selection to fail without probes")
+	}
+	if probes := prober.probes.Load(); probes != 2 {
+		t.Errorf("Expected on-demand probes to be rate limited, got %d probes", probes)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("Expected a rate limited selection to fail right away, took %v", elapsed)
+	}
+}
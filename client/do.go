@@ -0,0 +1,22 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Do sends a request to a replica picked by the client's selector and
+// returns the response. The request URL only needs a path, its scheme and
+// host are replaced by the replica's address. The path is used as the job
+// name if the config lists it as a job, otherwise the job is OtherJob. ctx
+// bounds both the selection and the request.
+//
+// As with http.Client, the caller must close the response body.
+func (c *Client) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return c.transport.RoundTrip(req.WithContext(ctx))
+}
+
+// do is Do for a request of the given job
+func (c *Client) do(ctx context.Context, job string, req *http.Request) (*http.Response, error) {
+	return c.transport.send(req.WithContext(ctx), job)
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDo(t *testing.T) {
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+r.URL.RequestURI()+" "+string(body))
+	}))
+	defer replica.Close()
+
+	c := NewClient(Config{ProbeRate: 1}, []string{serverAddr(replica)}, ModeRoundRobin)
+	defer c.Stop()
+
+	req, err := http.NewRequest(http.MethodPut, "/orders/42?dry_run=true", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if expected := "PUT /orders/42?dry_run=true payload"; string(body) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(body))
+	}
+}
+
+func TestRequestMethods(t *testing.T) {
+	var paths []string
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/medium" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer replica.Close()
+
+	c := NewClient(Config{ProbeRate: 1}, []string{serverAddr(replica)}, ModeRoundRobin)
+	defer c.Stop()
+
+	if err := c.Ping(); err != nil {
+		t.Errorf("Unexpected ping error: %v", err)
+	}
+	if err := c.BatchProcess([]string{"example"}); err != nil {
+		t.Errorf("Unexpected batch error: %v", err)
+	}
+	if err := c.MediumProcess(); err == nil {
+		t.Errorf("Expected server error for medium")
+	}
+
+	expected := []string{"GET /ping", "POST /batch", "POST /medium"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, paths)
+	}
+}
+
+// jobSelector records the jobs it is asked to pick a replica for
+type jobSelector struct {
+	server string
+	jobs   []string
+}
+
+func (s *jobSelector) Select(pool *ProbePool, job string) (string, error) {
+	s.jobs = append(s.jobs, job)
+	return s.server, nil
+}
+
+func TestRequestMethodJobs(t *testing.T) {
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer replica.Close()
+
+	selector := &jobSelector{server: serverAddr(replica)}
+	c := NewClient(Config{ProbeRate: 1}, []string{serverAddr(replica)}, ModeHCL, WithSelector(selector))
+	defer c.Stop()
+
+	c.Ping()
+	c.MediumProcess()
+	c.BatchProcess([]string{"example"})
+
+	expected := []string{"ping", "medium", "batch"}
+	if strings.Join(selector.jobs, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected jobs %v, got %v", expected, selector.jobs)
+	}
+}
+
+func TestRequestMethodErrors(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1}, nil, ModeRoundRobin)
+	defer c.Stop()
+
+	if err := c.Ping(); err == nil || !strings.HasPrefix(err.Error(), "no replica available") {
+		t.Errorf("Expected a no replica error, got %v", err)
+	}
+
+	c.SetServers([]string{"localhost:1"})
+	if err := c.Ping(); err == nil || !strings.HasPrefix(err.Error(), "ping failed") {
+		t.Errorf("Expected a ping error, got %v", err)
+	}
+}
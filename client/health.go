@@ -0,0 +1,264 @@
+package client
+
+import (
+	"go-prequel/metrics"
+	"slices"
+	"time"
+)
+
+// replicaHealth tracks the recent failures of a replica
+type replicaHealth struct {
+	failures  int // Consecutive probe and request failures
+	successes int // Consecutive successful probes while unhealthy
+	unhealthy bool
+}
+
+// Healthy reports whether the server is currently considered healthy.
+// Servers that have not failed yet are healthy.
+func (c *Client) Healthy(server string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.isUnhealthy(server)
+}
+
+// isUnhealthy reports whether the server is marked unhealthy. Callers must
+// hold c.mu.
+func (c *Client) isUnhealthy(server string) bool {
+	h, ok := c.health[server]
+	return ok && h.unhealthy
+}
+
+// recordFailure counts a failed probe or request against the server and
+// marks it unhealthy after UnhealthyThreshold consecutive failures. Its
+// probes are dropped so they stop competing in selection. Callers must hold
+// c.mu.
+func (c *Client) recordFailure(server string) {
+	h, ok := c.health[server]
+	if !ok {
+		h = &replicaHealth{}
+		c.health[server] = h
+	}
+	h.failures++
+	h.successes = 0
+	if h.unhealthy || h.failures < c.config.UnhealthyThreshold {
+		return
+	}
+
+	h.unhealthy = true
+	c.unhealthy++
+	c.availableStale = true
+	c.purgeProbes(server)
+	metrics.IncrementHealthTransition(server, "unhealthy")
+	metrics.UpdateUnhealthyServers(c.unhealthy)
+	c.logger.Printf("Server %s marked unhealthy after %d consecutive failures", server, h.failures)
+}
+
+// recordSuccess resets the failure count of the server. An unhealthy server
+// only recovers after HealthyThreshold consecutive successful probes, since
+// it receives no requests that could prove it healthy. Callers must hold
+// c.mu.
+func (c *Client) recordSuccess(server string, probe bool) {
+	h, ok := c.health[server]
+	if !ok {
+		return
+	}
+	h.failures = 0
+	if !h.unhealthy {
+		delete(c.health, server)
+		return
+	}
+	if !probe {
+		return
+	}
+
+	h.successes++
+	if h.successes < c.config.HealthyThreshold {
+		return
+	}
+	delete(c.health, server)
+	c.unhealthy--
+	c.availableStale = true
+	metrics.IncrementHealthTransition(server, "healthy")
+	metrics.UpdateUnhealthyServers(c.unhealthy)
+	c.logger.Printf("Server %s recovered after %d successful probes", server, h.successes)
+}
+
+// forgetHealth drops the health state of servers no longer in the pool.
+// Callers must hold c.mu and c.pool.mu.
+func (c *Client) forgetHealth() {
+	for server, h := range c.health {
+		if c.pool.contains(server) {
+			continue
+		}
+		if h.unhealthy {
+			c.unhealthy--
+		}
+		delete(c.health, server)
+	}
+	metrics.UpdateUnhealthyServers(c.unhealthy)
+
+	for server := range c.draining {
+		if !c.pool.contains(server) {
+			delete(c.draining, server)
+		}
+	}
+	for server := range c.hot {
+		if !c.pool.contains(server) {
+			delete(c.hot, server)
+		}
+	}
+}
+
+// recordDraining tracks whether the probed server announced it is shutting
+// down. A draining server's probes are dropped, so it is not selected until
+// a probe reports it serving again, e.g. after a restart, or every server is
+// draining. Callers must hold c.mu.
+func (c *Client) recordDraining(probe *ProbeInfo) {
+	server := probe.ServerID
+	if !probe.Draining {
+		if c.draining[server] {
+			delete(c.draining, server)
+			c.availableStale = true
+			c.logger.Printf("Server %s stopped draining", server)
+		}
+		return
+	}
+
+	if !c.draining[server] {
+		c.draining[server] = true
+		c.availableStale = true
+		c.purgeProbes(server)
+		c.logger.Printf("Server %s is draining", server)
+	}
+}
+
+// leftOut reports whether probes of the server should stay out of the probe
+// pool, where they would take slots from the servers selection picks from.
+// That is the case for unhealthy, ejected and draining servers, unless every
+// server is, as selection then falls back to them. Callers must hold c.mu
+// for writing.
+func (c *Client) leftOut(server string) bool {
+	if !c.isOut(server) {
+		return false
+	}
+	c.pool.mu.RLock()
+	defer c.pool.mu.RUnlock()
+	return len(c.availableServers()) > 0
+}
+
+// isOut reports whether the server is unhealthy, ejected or draining.
+// Callers must hold c.mu.
+func (c *Client) isOut(server string) bool {
+	return c.isUnhealthy(server) || c.isEjected(server) || c.draining[server]
+}
+
+// availableServers returns the servers of the pool that are not unhealthy,
+// ejected or draining. The list is only rebuilt after one of those states
+// or the pool changed, so selection does not scan the pool on every call.
+// Callers must hold c.mu for writing and c.pool.mu.
+func (c *Client) availableServers() []string {
+	if c.unhealthy == 0 && c.ejected == 0 && len(c.draining) == 0 {
+		return c.pool.Servers
+	}
+	if c.availableStale {
+		servers := make([]string, 0, len(c.pool.Servers))
+		for _, server := range c.pool.Servers {
+			if !c.isOut(server) {
+				servers = append(servers, server)
+			}
+		}
+		c.available = servers
+		c.availableStale = false
+	}
+	return c.available
+}
+
+// selectionPool returns the view handed to the selector, leaving out
+// unhealthy, ejected, draining and explicitly excluded servers and their
+// probes. If that leaves no server nothing is left out, as a possibly bad
+// replica beats failing every request. Probes of servers that recently
+// rejected a request are reported hot. Callers must hold c.mu for writing
+// and c.pool.mu.
+func (c *Client) selectionPool(excluded map[string]bool) *ProbePool {
+	pool := &ProbePool{
+		Probes:        c.probes,
+		Servers:       c.pool.Servers,
+		QRIFThreshold: c.config.QRIFThreshold,
+	}
+	// Applies to whichever probes end up in the view
+	defer c.heatRejected(pool)
+	if c.unhealthy == 0 && c.ejected == 0 && len(c.draining) == 0 && len(excluded) == 0 {
+		return pool
+	}
+
+	servers := c.availableServers()
+	for server := range excluded {
+		if c.pool.contains(server) && !c.isOut(server) {
+			// Only retries and hedges pay for copying the pool
+			servers = slices.DeleteFunc(slices.Clone(servers), func(server string) bool {
+				return excluded[server]
+			})
+			break
+		}
+	}
+	if len(servers) == 0 {
+		return pool
+	}
+	pool.Servers = servers
+	pool.Probes = filterProbes(c.probes, func(server string) bool {
+		return excluded[server] || c.isOut(server)
+	})
+	return pool
+}
+
+// filterProbes returns the probes whose server is not skipped. The probes
+// are only copied if one of them is skipped.
+func filterProbes(probes []ProbeInfo, skip func(server string) bool) []ProbeInfo {
+	for i, probe := range probes {
+		if !skip(probe.ServerID) {
+			continue
+		}
+		kept := slices.Clone(probes[:i])
+		for _, probe := range probes[i+1:] {
+			if !skip(probe.ServerID) {
+				kept = append(kept, probe)
+			}
+		}
+		return kept
+	}
+	return probes
+}
+
+// heatRejected marks the probes of servers that recently rejected a request
+// as hot in the view. Callers must hold c.mu.
+func (c *Client) heatRejected(pool *ProbePool) {
+	if len(c.hot) == 0 {
+		return
+	}
+	now := time.Now()
+	var probes []ProbeInfo
+	for i, probe := range pool.Probes {
+		if !c.isHot(probe.ServerID, now) {
+			continue
+		}
+		if probes == nil {
+			// The view may share its probes with the client
+			probes = slices.Clone(pool.Probes)
+		}
+		probes[i].NormalizedRIF = max(probe.NormalizedRIF, 1)
+	}
+	if probes != nil {
+		pool.Probes = probes
+	}
+}
+
+// purgeProbes drops all probes of the server. Callers must hold c.mu.
+func (c *Client) purgeProbes(server string) {
+	kept := c.probes[:0]
+	for _, probe := range c.probes {
+		if probe.ServerID != server {
+			kept = append(kept, probe)
+		}
+	}
+	c.probes = kept
+}
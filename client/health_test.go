@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUnhealthyServerExcluded(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1, QRIFThreshold: 0.75}, []string{"a", "b"}, ModeHCL)
+	c.Stop()
+	c.probes = []ProbeInfo{
+		{ServerID: "a", RIF: 1, NormalizedRIF: 0.1, Timestamp: time.Now()},
+		{ServerID: "b", RIF: 5, NormalizedRIF: 0.5, Timestamp: time.Now()},
+	}
+
+	// Failures below the threshold keep the server in rotation
+	c.mu.Lock()
+	c.recordFailure("a")
+	c.recordFailure("a")
+	c.mu.Unlock()
+	if !c.Healthy("a") {
+		t.Fatalf("Expected a to stay healthy below the threshold")
+	}
+
+	c.ReportOutcome(Outcome{Server: "a", Err: errors.New("connection refused")})
+	if c.Healthy("a") {
+		t.Fatalf("Expected a to be unhealthy after 3 consecutive failures")
+	}
+	for i := 0; i < 5; i++ {
+		server, err := c.SelectReplica("ping")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if server != "b" {
+			t.Errorf("Expected unhealthy server to be excluded, got %s", server)
+		}
+	}
+
+	// One successful probe is not enough to recover
+	c.mu.Lock()
+	c.recordSuccess("a", true)
+	c.mu.Unlock()
+	if c.Healthy("a") {
+		t.Fatalf("Expected a to stay unhealthy after a single successful probe")
+	}
+
+	c.mu.Lock()
+	c.recordSuccess("a", true)
+	c.mu.Unlock()
+	if !c.Healthy("a") {
+		t.Errorf("Expected a to recover after 2 successful probes")
+	}
+}
+
+func TestFailuresResetByResponse(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1}, []string{"a"}, ModeHCL)
+	c.Stop()
+
+	for i := 0; i < 5; i++ {
+		c.ReportOutcome(Outcome{Server: "a", Err: errors.New("connection reset")})
+		c.ReportOutcome(Outcome{Server: "a", StatusCode: http.StatusOK})
+	}
+	if !c.Healthy("a") {
+		t.Errorf("Expected non-consecutive failures to keep a healthy")
+	}
+}
+
+func TestAllServersUnhealthy(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1, UnhealthyThreshold: 1}, []string{"a", "b"}, ModeRoundRobin)
+	c.Stop()
+
+	c.mu.Lock()
+	c.recordFailure("a")
+	c.recordFailure("b")
+	c.mu.Unlock()
+
+	// Failing open beats failing every request
+	if _, err := c.SelectReplica("ping"); err != nil {
+		t.Errorf("Expected selection to fall back to unhealthy servers, got %v", err)
+	}
+
+	if err := c.RemoveServer("a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if c.unhealthy != 1 {
+		t.Errorf("Expected health of removed server to be forgotten, got %d unhealthy", c.unhealthy)
+	}
+}
+
+func TestRecoveredServerBackInRotation(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1, UnhealthyThreshold: 1, HealthyThreshold: 1}, []string{"a", "b", "c"}, ModeRoundRobin)
+	c.Stop()
+
+	selected := func() map[string]bool {
+		seen := make(map[string]bool)
+		for i := 0; i < 6; i++ {
+			server, err := c.SelectReplica("ping")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			seen[server] = true
+		}
+		return seen
+	}
+
+	c.mu.Lock()
+	c.recordFailure("a")
+	c.mu.Unlock()
+	if seen := selected(); seen["a"] || len(seen) != 2 {
+		t.Fatalf("Expected only b and c to be selected, got %v", seen)
+	}
+
+	c.mu.Lock()
+	c.recordSuccess("a", true)
+	c.recordFailure("b")
+	c.mu.Unlock()
+	if seen := selected(); seen["b"] || !seen["a"] {
+		t.Errorf("Expected a back in rotation and b left out, got %v", seen)
+	}
+}
+
+func TestDrainingServerExcluded(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1, QRIFThreshold: 0.75}, []string{"a", "b"}, ModeHCL)
+	c.Stop()
+	c.probes = []ProbeInfo{
+		{ServerID: "a", RIF: 1, NormalizedRIF: 0.1, Timestamp: time.Now()},
+		{ServerID: "b", RIF: 5, NormalizedRIF: 0.5, Timestamp: time.Now()},
+	}
+
+	c.mu.Lock()
+	c.recordDraining(&ProbeInfo{ServerID: "a", Draining: true})
+	left := c.leftOut("a")
+	c.mu.Unlock()
+	if !left {
+		t.Fatalf("Expected the draining probe to be dropped")
+	}
+	for i := 0; i < 5; i++ {
+		server, err := c.SelectReplica("ping")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if server != "b" {
+			t.Errorf("Expected draining server to be excluded, got %s", server)
+		}
+	}
+
+	// A restarted replica reports serving again
+	c.mu.Lock()
+	c.recordDraining(&ProbeInfo{ServerID: "a"})
+	left = c.leftOut("a")
+	c.mu.Unlock()
+	if left || c.draining["a"] {
+		t.Errorf("Expected a to be selectable once it stops draining")
+	}
+}
+
+// okProber answers every probe with the same RIF
+type okProber struct{}
+
+func (okProber) Probe(ctx context.Context, server string) (*ProbeInfo, error) {
+	return &ProbeInfo{ServerID: server, RIF: 1, Timestamp: time.Now()}, nil
+}
+
+func TestUnhealthyServerProbesLeaveThePool(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1, UnhealthyThreshold: 1, HealthyThreshold: 10}, []string{"a", "b"}, ModeHCL, WithProber(okProber{}))
+	c.Stop()
+
+	c.mu.Lock()
+	c.recordFailure("a")
+	c.mu.Unlock()
+
+	// a stays unhealthy for the next probes
+	for i := 0; i < 2; i++ {
+		c.probeRandom(context.Background(), 2)
+	}
+	for _, probe := range c.probes {
+		if probe.ServerID == "a" {
+			t.Fatalf("Expected probes of unhealthy a to stay out of the pool")
+		}
+	}
+
+	// With every server unhealthy their probes are kept to fail open
+	c.mu.Lock()
+	c.recordFailure("b")
+	c.mu.Unlock()
+	c.probeRandom(context.Background(), 2)
+	if len(c.probes) == 0 {
+		t.Errorf("Expected probes to be kept when every server is unhealthy")
+	}
+}
+
+// drainingProber reports every replica draining
+type drainingProber struct{}
+
+func (drainingProber) Probe(ctx context.Context, server string) (*ProbeInfo, error) {
+	return &ProbeInfo{ServerID: server, RIF: 1, Timestamp: time.Now(), Draining: true}, nil
+}
+
+func TestAllServersDraining(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1}, []string{"a", "b"}, ModeHCL, WithProber(drainingProber{}))
+	c.Stop()
+
+	// Draining replicas still serve, so they beat failing every request
+	c.probeRandom(context.Background(), 2)
+	if len(c.probes) == 0 {
+		t.Fatalf("Expected probes to be kept when every server is draining")
+	}
+	if _, err := c.SelectReplica("ping"); err != nil {
+		t.Errorf("Expected selection to fall back to draining servers, got %v", err)
+	}
+}
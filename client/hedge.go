@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"go-prequel/metrics"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// HedgePolicy configures hedged requests: if a request to one replica has
+// not been answered after a delay, the same request is sent to a second
+// replica, the first response wins and the other request is cancelled.
+// Hedging is opt-in per job and, like retries, limited to idempotent
+// requests.
+type HedgePolicy struct {
+	Jobs       []string      `json:"jobs"`       // Jobs to hedge, e.g. "/ping"
+	Delay      time.Duration `json:"delay"`      // Time to wait for a response before hedging
+	Percentile float64       `json:"percentile"` // Hedge after this percentile of the job's observed latency instead, e.g. 0.95
+}
+
+// hedges reports whether requests for the job are hedged
+func (p HedgePolicy) hedges(job string) bool {
+	return (p.Delay > 0 || p.Percentile > 0) && slices.Contains(p.Jobs, job)
+}
+
+const (
+	// latencyWindowSize is the number of recent latencies kept per job
+	latencyWindowSize = 128
+	// minLatencySamples is the number of latencies needed before the
+	// percentile is trusted over the fixed delay
+	minLatencySamples = 20
+)
+
+// latencyWindow holds the most recent latencies of a job
+type latencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	sorted := slices.Clone(w.samples)
+	slices.Sort(sorted)
+	return sorted[min(int(p*float64(len(sorted))), len(sorted)-1)]
+}
+
+// jobLatencies tracks recent latencies of hedged jobs
+type jobLatencies struct {
+	windows map[string]*latencyWindow
+	mu      sync.Mutex
+}
+
+func (l *jobLatencies) observe(job string, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.windows == nil {
+		l.windows = make(map[string]*latencyWindow)
+	}
+	w, ok := l.windows[job]
+	if !ok {
+		w = &latencyWindow{}
+		l.windows[job] = w
+	}
+	w.add(latency)
+}
+
+// hedgeDelay returns how long to wait before hedging a request for the
+// job. The percentile delay is used once enough latencies were observed,
+// the fixed delay until then.
+func (l *jobLatencies) hedgeDelay(job string, policy HedgePolicy) time.Duration {
+	if policy.Percentile <= 0 {
+		return policy.Delay
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w, ok := l.windows[job]
+	if !ok || len(w.samples) < minLatencySamples {
+		return policy.Delay
+	}
+	return w.percentile(policy.Percentile)
+}
+
+// attemptResult is the result of one of the requests of a hedged attempt
+type attemptResult struct {
+	resp   *http.Response
+	err    error
+	hedge  bool
+	cancel context.CancelFunc
+}
+
+// hedge sends req to server and, if it has not answered within the hedge
+// delay, to a second replica avoiding server and the excluded ones. It
+// returns the first successful response, or the last failure, and the
+// address of the hedge replica if one was used. The losing request is
+// cancelled. rewind is passed on to outgoing for the first request.
+func (t *Transport) hedge(base http.RoundTripper, req *http.Request, server, job string, excluded map[string]bool, policy HedgePolicy, rewind bool) (*http.Response, string, error) {
+	results := make(chan attemptResult, 2)
+	cancels := make(map[bool]context.CancelFunc, 2) // by hedge
+	send := func(server string, hedge bool) error {
+		ctx, cancel := context.WithCancel(req.Context())
+		out, err := t.outgoing(req.WithContext(ctx), server, rewind || hedge)
+		if err != nil {
+			cancel()
+			return err
+		}
+		cancels[hedge] = cancel
+		go func() {
+			start := time.Now()
+			resp, err := t.client.roundTrip(base, out, server, job)
+			if err == nil && resp.StatusCode < http.StatusInternalServerError {
+				t.client.latencies.observe(job, time.Since(start))
+			}
+			results <- attemptResult{resp: resp, err: err, hedge: hedge, cancel: cancel}
+		}()
+		return nil
+	}
+
+	if err := send(server, false); err != nil {
+		closeBody(req)
+		return nil, "", err
+	}
+	timer := time.NewTimer(t.client.latencies.hedgeDelay(job, policy))
+	defer timer.Stop()
+
+	inflight := 1
+	var hedgeServer string
+	select {
+	case r := <-results:
+		return r.finish(), "", r.err
+	case <-timer.C:
+		avoid := make(map[string]bool, len(excluded)+1)
+		for s := range excluded {
+			avoid[s] = true
+		}
+		avoid[server] = true
+		// The hedge is best effort, the first request keeps going if no
+		// other replica is available. Unlike the first request it does not
+		// probe for one, which would leave a response waiting on probes.
+		if s, err := t.client.selectReplica(job, avoid); err == nil && s != server {
+			if send(s, true) == nil {
+				hedgeServer = s
+				inflight++
+			}
+		}
+	}
+
+	var r attemptResult
+	for inflight > 0 {
+		r = <-results
+		inflight--
+		if inflight > 0 && retryable(r.resp, r.err) {
+			// Give the other request a chance to do better
+			r.discard()
+			continue
+		}
+		break
+	}
+	if hedgeServer != "" {
+		result := "lost"
+		if r.hedge {
+			result = "won"
+		}
+		metrics.IncrementHedge(job, result)
+	}
+
+	// Cancel the loser and release its response once it returns
+	if inflight > 0 {
+		cancels[!r.hedge]()
+		go func() {
+			loser := <-results
+			loser.discard()
+		}()
+	}
+	return r.finish(), hedgeServer, r.err
+}
+
+// finish hands out the response of a request, cancelling its context once
+// the caller is done with the body
+func (r attemptResult) finish() *http.Response {
+	if r.resp == nil {
+		r.cancel()
+		return nil
+	}
+	r.resp.Body = &cancelBody{ReadCloser: r.resp.Body, cancel: r.cancel}
+	return r.resp
+}
+
+// discard releases a response nobody will read
+func (r attemptResult) discard() {
+	discard(r.resp)
+	r.cancel()
+}
+
+// cancelBody cancels the request context when the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newDelayServer starts a replica that answers with its name after delay,
+// reporting cancelled requests on the channel
+func newDelayServer(t *testing.T, name string, delay time.Duration, cancelled chan<- string) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+			io.WriteString(w, name)
+		case <-r.Context().Done():
+			cancelled <- name
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestHedgedRequest(t *testing.T) {
+	cancelled := make(chan string, 2)
+	slow := newDelayServer(t, "slow", 5*time.Second, cancelled)
+	fast := newDelayServer(t, "fast", 0, cancelled)
+	c := NewClient(Config{
+		ProbeRate: 1,
+		Hedge:     HedgePolicy{Jobs: []string{"/ping"}, Delay: 20 * time.Millisecond},
+	}, []string{serverAddr(slow), serverAddr(fast)}, ModeRoundRobin)
+	t.Cleanup(c.Stop)
+
+	// Round robin starts with the slow replica, so the hedge has to win
+	start := time.Now()
+	req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "fast" {
+		t.Errorf("Expected the hedge to win, got %q", body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Hedged request took %v", elapsed)
+	}
+	select {
+	case name := <-cancelled:
+		if name != "slow" {
+			t.Errorf("Expected the slow request to be cancelled, got %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected the losing request to be cancelled")
+	}
+}
+
+func TestHedgeOnlyConfiguredJobs(t *testing.T) {
+	cancelled := make(chan string, 2)
+	slow := newDelayServer(t, "slow", 100*time.Millisecond, cancelled)
+	fast := newDelayServer(t, "fast", 0, cancelled)
+	c := NewClient(Config{
+		ProbeRate: 1,
+		Hedge:     HedgePolicy{Jobs: []string{"/ping"}, Delay: 10 * time.Millisecond},
+	}, []string{serverAddr(slow), serverAddr(fast)}, ModeRoundRobin)
+	t.Cleanup(c.Stop)
+
+	req, _ := http.NewRequest(http.MethodGet, "/medium", nil)
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "slow" {
+		t.Errorf("Expected no hedge for /medium, got %q", body)
+	}
+}
+
+func TestHedgeDelayPercentile(t *testing.T) {
+	var l jobLatencies
+	policy := HedgePolicy{Delay: time.Second, Percentile: 0.9}
+	if delay := l.hedgeDelay("/ping", policy); delay != time.Second {
+		t.Errorf("Expected the fixed delay without samples, got %v", delay)
+	}
+
+	for i := 1; i <= 100; i++ {
+		l.observe("/ping", time.Duration(i)*time.Millisecond)
+	}
+	if delay := l.hedgeDelay("/ping", policy); delay != 91*time.Millisecond {
+		t.Errorf("Expected the 90th percentile, got %v", delay)
+	}
+}
+
+func TestHedgeAvoidsPrimaryWithHCL(t *testing.T) {
+	cancelled := make(chan string, 2)
+	slow := newDelayServer(t, "slow", 5*time.Second, cancelled)
+	fast := newDelayServer(t, "fast", 0, cancelled)
+	c := NewClient(Config{
+		ProbeRate:     1,
+		QRIFThreshold: 0.75,
+		Hedge:         HedgePolicy{Jobs: []string{"/ping"}, Delay: 20 * time.Millisecond},
+	}, []string{serverAddr(slow), serverAddr(fast)}, ModeHCL)
+	c.Stop()
+	// HCL prefers the slow replica, the hedge must go to the other one
+	c.probes = []ProbeInfo{
+		{ServerID: serverAddr(slow), RIF: 1, NormalizedRIF: 0.1, Timestamp: time.Now()},
+		{ServerID: serverAddr(fast), RIF: 5, NormalizedRIF: 0.5, Timestamp: time.Now()},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "fast" {
+		t.Errorf("Expected the hedge to go to the fast replica, got %q", body)
+	}
+}
+
+// hangingProber never answers before the probe is abandoned
+type hangingProber struct{}
+
+func (hangingProber) Probe(ctx context.Context, server string) (*ProbeInfo, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestHedgeDoesNotWaitForProbes(t *testing.T) {
+	cancelled := make(chan string, 2)
+	primary := newDelayServer(t, "primary", 50*time.Millisecond, cancelled)
+	other := newDelayServer(t, "other", 0, cancelled)
+	c := NewClient(Config{
+		ProbeRate:    1,
+		ProbeTimeout: 2 * time.Second,
+		Hedge:        HedgePolicy{Jobs: []string{"/ping"}, Delay: 10 * time.Millisecond},
+	}, []string{serverAddr(primary), serverAddr(other)}, ModeHCL, WithProber(hangingProber{}))
+	c.Stop()
+	// Nothing is left to hedge on once the primary is avoided
+	c.probes = []ProbeInfo{{ServerID: serverAddr(primary), RIF: 1, Timestamp: time.Now()}}
+
+	start := time.Now()
+	req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "primary" {
+		t.Errorf("Expected the primary to answer, got %q", body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the hedge not to wait for probes, took %v", elapsed)
+	}
+}
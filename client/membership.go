@@ -0,0 +1,146 @@
+package client
+
+import (
+	"fmt"
+	"go-prequel/metrics"
+)
+
+// AddServer adds a server to the pool. The server is probed from the next
+// probe tick onwards.
+func (c *Client) AddServer(server string) error {
+	if server == "" {
+		return fmt.Errorf("empty server address")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	if c.pool.contains(server) {
+		return fmt.Errorf("server %s already in pool", server)
+	}
+	c.applyServers(append(append([]string(nil), c.pool.Servers...), server))
+	return nil
+}
+
+// RemoveServer removes a server from the pool along with all of its probes
+func (c *Client) RemoveServer(server string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	i, ok := c.pool.index[server]
+	if !ok {
+		return fmt.Errorf("server %s not in pool", server)
+	}
+	servers := make([]string, 0, len(c.pool.Servers)-1)
+	servers = append(servers, c.pool.Servers[:i]...)
+	servers = append(servers, c.pool.Servers[i+1:]...)
+	c.applyServers(servers)
+	return nil
+}
+
+// SetServers replaces the server pool, keeping the probes of servers that
+// remain in the pool and purging the rest
+func (c *Client) SetServers(servers []string) error {
+	for _, server := range servers {
+		if server == "" {
+			return fmt.Errorf("empty server address")
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pool.mu.Lock()
+	defer c.pool.mu.Unlock()
+
+	c.applyServers(dedupeServers(servers))
+	return nil
+}
+
+// Servers returns a copy of the current server pool
+func (c *Client) Servers() []string {
+	c.pool.mu.RLock()
+	defer c.pool.mu.RUnlock()
+	return append([]string(nil), c.pool.Servers...)
+}
+
+// applyServers swaps in a new server list. Callers must hold both c.mu and
+// c.pool.mu, and must not modify servers afterwards.
+func (c *Client) applyServers(servers []string) {
+	index := indexServers(servers)
+
+	added, removed := 0, 0
+	for _, server := range servers {
+		if !c.pool.contains(server) {
+			added++
+		}
+	}
+	for _, server := range c.pool.Servers {
+		if _, ok := index[server]; !ok {
+			removed++
+		}
+	}
+
+	c.pool.Servers = servers
+	c.pool.index = index
+	c.availableStale = true
+
+	// Purge probes of removed servers
+	if removed > 0 {
+		kept := c.probes[:0]
+		for _, probe := range c.probes {
+			if c.pool.contains(probe.ServerID) {
+				kept = append(kept, probe)
+			}
+		}
+		c.probes = kept
+		c.forgetHealth()
+		c.forgetOutliers()
+	}
+
+	if c.autoReplicas {
+		c.config.NumReplicas = len(servers)
+		c.config.MaxProbeUse = calculateBReuse(c.config)
+	}
+
+	if listener, ok := c.selector.(MembershipListener); ok {
+		listener.ServersChanged(servers)
+	}
+
+	metrics.AddMembershipChanges("added", added)
+	metrics.AddMembershipChanges("removed", removed)
+	metrics.UpdateServerPoolSize(len(servers))
+	if added > 0 || removed > 0 {
+		c.logger.Printf("Server pool updated: %d added, %d removed, %d servers", added, removed, len(servers))
+	}
+}
+
+// contains reports whether the server is in the pool. Callers must hold p.mu.
+func (p *ServerPool) contains(server string) bool {
+	_, ok := p.index[server]
+	return ok
+}
+
+func indexServers(servers []string) map[string]int {
+	index := make(map[string]int, len(servers))
+	for i, server := range servers {
+		index[server] = i
+	}
+	return index
+}
+
+// dedupeServers drops repeated addresses, keeping the first occurrence
+func dedupeServers(servers []string) []string {
+	seen := make(map[string]bool, len(servers))
+	deduped := make([]string, 0, len(servers))
+	for _, server := range servers {
+		if !seen[server] {
+			seen[server] = true
+			deduped = append(deduped, server)
+		}
+	}
+	return deduped
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMembershipChanges(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1}, []string{"a", "b", "c"}, ModeRoundRobin)
+	c.Stop()
+	c.probes = []ProbeInfo{
+		{ServerID: "a", Timestamp: time.Now()},
+		{ServerID: "b", Timestamp: time.Now()},
+		{ServerID: "c", Timestamp: time.Now()},
+	}
+
+	if err := c.AddServer("d"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.AddServer("d"); err == nil {
+		t.Errorf("Expected error adding duplicate server")
+	}
+	if c.config.NumReplicas != 4 {
+		t.Errorf("Expected NumReplicas to follow pool size, got %d", c.config.NumReplicas)
+	}
+
+	if err := c.RemoveServer("b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.RemoveServer("b"); err == nil {
+		t.Errorf("Expected error removing unknown server")
+	}
+	for _, probe := range c.probes {
+		if probe.ServerID == "b" {
+			t.Errorf("Expected probes of removed server to be purged")
+		}
+	}
+
+	if err := c.SetServers([]string{"c", "e", "e"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	servers := c.Servers()
+	if len(servers) != 2 || servers[0] != "c" || servers[1] != "e" {
+		t.Errorf("Expected [c e], got %v", servers)
+	}
+	if len(c.probes) != 1 || c.probes[0].ServerID != "c" {
+		t.Errorf("Expected only probes of c to remain, got %+v", c.probes)
+	}
+}
+
+func TestRoundRobinAfterMembershipChange(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1}, []string{"a", "b", "c"}, ModeRoundRobin)
+	c.Stop()
+
+	if server, _ := c.SelectReplica("ping"); server != "a" {
+		t.Fatalf("Expected a, got %v", server)
+	}
+	if err := c.SetServers([]string{"x", "a", "c"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{"c", "x", "a"} {
+		if server, _ := c.SelectReplica("ping"); server != expected {
+			t.Errorf("Expected %v, got %v", expected, server)
+		}
+	}
+
+	if err := c.SetServers([]string{"y"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if server, _ := c.SelectReplica("ping"); server != "y" {
+		t.Errorf("Expected y, got %v", server)
+	}
+}
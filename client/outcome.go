@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"go-prequel/metrics"
+	"net/http"
+	"time"
+)
+
+// Outcome describes how a request sent to a replica went
+type Outcome struct {
+	Server     string
+	Job        string
+	StatusCode int   // Response status, 0 if no response was received
+	Err        error // Transport error, if any
+	Latency    time.Duration
+
+	// Set if the replica shed the request, with the time it asked to be
+	// spared for
+	Rejected   bool
+	RetryAfter time.Duration
+}
+
+// Cancelled reports whether the request was abandoned by the caller, which
+// says nothing about the health of the replica
+func (o Outcome) Cancelled() bool {
+	return errors.Is(o.Err, context.Canceled) || errors.Is(o.Err, context.DeadlineExceeded)
+}
+
+// result classifies the outcome for metrics
+func (o Outcome) result() string {
+	switch {
+	case o.Cancelled():
+		return "cancelled"
+	case o.Err != nil:
+		return "error"
+	case o.Rejected:
+		return "rejected"
+	case o.StatusCode >= http.StatusInternalServerError:
+		return "server_error"
+	default:
+		return "success"
+	}
+}
+
+// ReportOutcome feeds the outcome of a request back into the client.
+// Transport errors count towards marking the server unhealthy; any response
+// resets the count. Transport errors and 5xx responses also feed outlier
+// detection, where only 5xx responses count as consecutive failures.
+// Rejections mark the server hot rather than failing it, as the replica is
+// healthy but overloaded. Cancelled requests are ignored.
+func (c *Client) ReportOutcome(outcome Outcome) {
+	result := outcome.result()
+	metrics.IncrementRequestOutcome(outcome.Server, result)
+	metrics.ObserveClientRequestLatency(outcome.Job, outcome.Latency)
+	if result == "cancelled" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Outcomes of servers removed while the request was in flight are moot
+	c.pool.mu.RLock()
+	member := c.pool.contains(outcome.Server)
+	c.pool.mu.RUnlock()
+	if !member {
+		return
+	}
+	if result == "error" {
+		c.recordFailure(outcome.Server)
+	} else {
+		c.recordSuccess(outcome.Server, false)
+	}
+	if result == "rejected" {
+		c.markHot(outcome.Server, outcome.RetryAfter)
+		return
+	}
+	c.recordRequest(outcome.Server, result, time.Now())
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"go-prequel/metrics"
+	"math"
+	"time"
+)
+
+// OutlierConfig configures outlier detection, which temporarily ejects
+// replicas whose requests fail more often than their peers'. It follows
+// Envoy's outlier detection: a replica is ejected after Consecutive5xx
+// 5xx responses in a row, or when its success rate over an interval falls
+// more than SuccessRateStdevFactor standard deviations below the mean.
+// Transport errors are left to health checking and only count against the
+// success rate.
+type OutlierConfig struct {
+	Consecutive5xx           int           `json:"consecutive_5xx"`             // 5xx responses in a row that eject a replica (default 5)
+	Interval                 time.Duration `json:"interval"`                    // Time between success rate analyses and ejection checks (default 10s)
+	BaseEjectionTime         time.Duration `json:"base_ejection_time"`          // Time of a first ejection, doubled for every recent ejection (default 30s)
+	MaxEjectionTime          time.Duration `json:"max_ejection_time"`           // Upper bound for the ejection time (default 300s)
+	MaxEjectionPercent       *int          `json:"max_ejection_percent"`        // Share of the pool that may be ejected at once, at least one replica; 0 disables ejection (default 10 if unset)
+	SuccessRateMinHosts      int           `json:"success_rate_minimum_hosts"`  // Replicas with enough requests needed for success rate analysis (default 5)
+	SuccessRateRequestVolume int           `json:"success_rate_request_volume"` // Requests per interval needed to include a replica in the analysis (default 100)
+	SuccessRateStdevFactor   float64       `json:"success_rate_stdev_factor"`   // Deviation below the mean success rate that ejects a replica (default 1.9)
+}
+
+// outlierStats tracks the request outcomes of a replica
+type outlierStats struct {
+	consecutive5xx int
+	successes      int // Successful requests in the current interval
+	requests       int // Requests in the current interval
+	ejections      int // Recent ejections, drives the exponential backoff
+	ejectedUntil   time.Time
+	ejected        bool
+}
+
+// outlierLoop runs the periodic outlier analysis until the client stops
+func (c *Client) outlierLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-c.outlierTicker.C:
+			c.mu.Lock()
+			c.sweepOutliers(now)
+			c.mu.Unlock()
+		}
+	}
+}
+
+// isEjected reports whether the server is ejected. Callers must hold c.mu.
+func (c *Client) isEjected(server string) bool {
+	s, ok := c.outliers[server]
+	return ok && s.ejected
+}
+
+// outlierStatsFor returns the stats of the server, creating them if needed.
+// Callers must hold c.mu.
+func (c *Client) outlierStatsFor(server string) *outlierStats {
+	s, ok := c.outliers[server]
+	if !ok {
+		s = &outlierStats{}
+		c.outliers[server] = s
+	}
+	return s
+}
+
+// recordRequest counts a request outcome towards outlier detection. 5xx
+// responses and transport errors fail the success rate, but only 5xx
+// responses count towards Consecutive5xx. Callers must hold c.mu.
+func (c *Client) recordRequest(server string, result string, now time.Time) {
+	s := c.outlierStatsFor(server)
+	s.requests++
+	switch result {
+	case "success":
+		s.successes++
+		s.consecutive5xx = 0
+		return
+	case "error":
+		return
+	}
+
+	s.consecutive5xx++
+	if s.consecutive5xx >= c.config.Outlier.Consecutive5xx {
+		s.consecutive5xx = 0
+		c.ejectOutlier(server, s, "consecutive_5xx", now)
+	}
+}
+
+// ejectOutlier ejects the server unless it already is or the ejection limit
+// is reached. Callers must hold c.mu.
+func (c *Client) ejectOutlier(server string, s *outlierStats, reason string, now time.Time) {
+	if s.ejected {
+		return
+	}
+	c.pool.mu.RLock()
+	servers := len(c.pool.Servers)
+	c.pool.mu.RUnlock()
+	if c.ejected >= maxEjections(servers, *c.config.Outlier.MaxEjectionPercent) {
+		return
+	}
+
+	s.ejections++
+	ejection := c.config.Outlier.MaxEjectionTime
+	if shift := s.ejections - 1; shift < 32 {
+		ejection = min(c.config.Outlier.BaseEjectionTime<<shift, ejection)
+	}
+	s.ejected = true
+	s.ejectedUntil = now.Add(ejection)
+	c.ejected++
+	c.availableStale = true
+	c.purgeProbes(server)
+
+	metrics.IncrementOutlierEjection(server, reason)
+	metrics.UpdateEjectedServers(c.ejected)
+	c.logger.Printf("Server %s ejected for %v (%s)", server, ejection, reason)
+}
+
+// maxEjections returns how many of n servers may be ejected at once. At
+// least one may always be ejected, so small pools are still protected.
+func maxEjections(n, percent int) int {
+	if percent <= 0 {
+		return 0
+	}
+	return max(1, n*percent/100)
+}
+
+// sweepOutliers brings back replicas whose ejection expired, ejects
+// replicas with outlying success rates and starts a new interval.
+// Callers must hold c.mu.
+func (c *Client) sweepOutliers(now time.Time) {
+	for server, s := range c.outliers {
+		if s.ejected && !now.Before(s.ejectedUntil) {
+			s.ejected = false
+			c.ejected--
+			c.availableStale = true
+			metrics.UpdateEjectedServers(c.ejected)
+			c.logger.Printf("Server %s returned from ejection", server)
+		} else if !s.ejected && s.ejections > 0 {
+			// Backoff decays while the replica behaves
+			s.ejections--
+		}
+	}
+
+	c.ejectSuccessRateOutliers(now)
+
+	for server, s := range c.outliers {
+		s.successes, s.requests = 0, 0
+		if !s.ejected && s.ejections == 0 && s.consecutive5xx == 0 {
+			delete(c.outliers, server)
+		}
+	}
+}
+
+// ejectSuccessRateOutliers ejects replicas whose success rate in the
+// current interval lies far below that of their peers. Callers must hold
+// c.mu.
+func (c *Client) ejectSuccessRateOutliers(now time.Time) {
+	config := c.config.Outlier
+	rates := make(map[string]float64)
+	for server, s := range c.outliers {
+		if !s.ejected && s.requests >= config.SuccessRateRequestVolume {
+			rates[server] = float64(s.successes) / float64(s.requests)
+		}
+	}
+	if len(rates) < config.SuccessRateMinHosts {
+		return
+	}
+
+	var mean float64
+	for _, rate := range rates {
+		mean += rate
+	}
+	mean /= float64(len(rates))
+	var variance float64
+	for _, rate := range rates {
+		variance += (rate - mean) * (rate - mean)
+	}
+	threshold := mean - config.SuccessRateStdevFactor*math.Sqrt(variance/float64(len(rates)))
+
+	for server, rate := range rates {
+		if rate < threshold {
+			c.ejectOutlier(server, c.outliers[server], "success_rate", now)
+		}
+	}
+}
+
+// forgetOutliers drops the outlier state of servers no longer in the pool.
+// Callers must hold c.mu and c.pool.mu.
+func (c *Client) forgetOutliers() {
+	for server, s := range c.outliers {
+		if c.pool.contains(server) {
+			continue
+		}
+		if s.ejected {
+			c.ejected--
+		}
+		delete(c.outliers, server)
+	}
+	metrics.UpdateEjectedServers(c.ejected)
+}
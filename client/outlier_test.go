@@ -0,0 +1,166 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newOutlierTestClient(t *testing.T, servers []string, outlier OutlierConfig) *Client {
+	t.Helper()
+	c := NewClient(Config{ProbeRate: 1, Outlier: outlier}, servers, ModeRoundRobin)
+	c.Stop()
+	return c
+}
+
+func TestConsecutive5xxEjection(t *testing.T) {
+	c := newOutlierTestClient(t, []string{"a", "b"}, OutlierConfig{
+		Consecutive5xx:     3,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    3 * time.Minute,
+		MaxEjectionPercent: percent(50),
+	})
+
+	for i := 0; i < 3; i++ {
+		c.ReportOutcome(Outcome{Server: "a", StatusCode: http.StatusInternalServerError})
+	}
+	c.mu.RLock()
+	ejected := c.isEjected("a")
+	c.mu.RUnlock()
+	if !ejected {
+		t.Fatalf("Expected a to be ejected after 3 consecutive 5xx")
+	}
+	for i := 0; i < 4; i++ {
+		if server, _ := c.SelectReplica("ping"); server != "b" {
+			t.Errorf("Expected ejected server to be skipped, got %s", server)
+		}
+	}
+
+	// The second ejection lasts twice as long, the third is capped
+	now := time.Now()
+	for i, expected := range []time.Duration{2 * time.Minute, 3 * time.Minute} {
+		c.mu.Lock()
+		c.sweepOutliers(c.outliers["a"].ejectedUntil)
+		s := c.outliers["a"]
+		if s.ejected {
+			t.Fatalf("Expected a to return after its ejection time")
+		}
+		c.ejectOutlier("a", s, "consecutive_5xx", now)
+		if got := s.ejectedUntil.Sub(now); got != expected {
+			t.Errorf("Ejection %d: expected %v, got %v", i+2, expected, got)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func TestMaxEjectionPercent(t *testing.T) {
+	c := newOutlierTestClient(t, []string{"a", "b", "c", "d"}, OutlierConfig{
+		Consecutive5xx:     1,
+		MaxEjectionPercent: percent(25),
+	})
+
+	for _, server := range []string{"a", "b", "c"} {
+		c.ReportOutcome(Outcome{Server: server, StatusCode: http.StatusBadGateway})
+	}
+	if c.ejected != 1 {
+		t.Errorf("Expected at most 1 of 4 servers to be ejected, got %d", c.ejected)
+	}
+}
+
+func TestSuccessRateEjection(t *testing.T) {
+	servers := make([]string, 6)
+	for i := range servers {
+		servers[i] = fmt.Sprintf("server-%d", i)
+	}
+	c := newOutlierTestClient(t, servers, OutlierConfig{
+		Consecutive5xx:           1000,
+		MaxEjectionPercent:       percent(50),
+		SuccessRateRequestVolume: 10,
+	})
+
+	// server-0 fails half of its requests, its peers none
+	for i := 0; i < 20; i++ {
+		for j, server := range servers {
+			status := http.StatusOK
+			if j == 0 && i%2 == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			c.ReportOutcome(Outcome{Server: server, StatusCode: status})
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweepOutliers(time.Now())
+	for _, server := range servers {
+		if expected := server == "server-0"; c.isEjected(server) != expected {
+			t.Errorf("%s: expected ejected=%v", server, expected)
+		}
+	}
+}
+
+func TestConsecutive5xxIgnoresTransportErrors(t *testing.T) {
+	c := newOutlierTestClient(t, []string{"a", "b"}, OutlierConfig{
+		Consecutive5xx:     2,
+		MaxEjectionPercent: percent(50),
+	})
+
+	c.ReportOutcome(Outcome{Server: "a", StatusCode: http.StatusInternalServerError})
+	c.ReportOutcome(Outcome{Server: "a", Err: errors.New("connection refused")})
+	c.mu.RLock()
+	ejected := c.isEjected("a")
+	c.mu.RUnlock()
+	if ejected {
+		t.Errorf("Expected transport errors not to count as 5xx")
+	}
+
+	c.ReportOutcome(Outcome{Server: "a", StatusCode: http.StatusInternalServerError})
+	c.mu.RLock()
+	ejected = c.isEjected("a")
+	c.mu.RUnlock()
+	if !ejected {
+		t.Errorf("Expected a to be ejected after 2 consecutive 5xx")
+	}
+}
+
+func TestOutlierDefaults(t *testing.T) {
+	var config OutlierConfig
+	setOutlierDefaults(&config)
+	if *config.MaxEjectionPercent != 10 {
+		t.Errorf("Expected max_ejection_percent to default to 10, got %d", *config.MaxEjectionPercent)
+	}
+
+	// Setting other fields keeps ejection on
+	config = OutlierConfig{Consecutive5xx: 3}
+	setOutlierDefaults(&config)
+	if *config.MaxEjectionPercent != 10 {
+		t.Errorf("Expected max_ejection_percent to default to 10 with a partial block, got %d", *config.MaxEjectionPercent)
+	}
+
+	config = OutlierConfig{MaxEjectionPercent: percent(0)}
+	setOutlierDefaults(&config)
+	if *config.MaxEjectionPercent != 0 {
+		t.Errorf("Expected an explicit max_ejection_percent of 0 to be kept, got %d", *config.MaxEjectionPercent)
+	}
+	if maxEjections(10, *config.MaxEjectionPercent) != 0 {
+		t.Errorf("Expected no ejections with max_ejection_percent 0")
+	}
+}
+
+func TestOutlierDefaultsFromJSON(t *testing.T) {
+	var config Config
+	if err := json.Unmarshal([]byte(`{"outlier_detection": {"consecutive_5xx": 3}}`), &config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	setDefaults(&config)
+	if *config.Outlier.MaxEjectionPercent != 10 {
+		t.Errorf("Expected max_ejection_percent to default to 10, got %d", *config.Outlier.MaxEjectionPercent)
+	}
+}
+
+func percent(p int) *int {
+	return &p
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-prequel/metrics"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Prober fetches the load signals of a single replica
+type Prober interface {
+	Probe(ctx context.Context, server string) (*ProbeInfo, error)
+}
+
+// WithProber makes the client probe replicas with the given prober instead
+// of over HTTP
+func WithProber(prober Prober) Option {
+	return func(c *Client) {
+		c.prober = prober
+	}
+}
+
+// HTTPProber probes replicas through their /probe HTTP endpoint
+type HTTPProber struct {
+	client *http.Client
+}
+
+// NewHTTPProber creates a prober with a dedicated HTTP client. Its
+// connections are kept alive between probes, so a probe usually costs a
+// single round-trip, and are not shared with the request path.
+func NewHTTPProber() *HTTPProber {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        0, // Bounded per host instead
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+		DisableCompression:  true,
+	}
+	return NewHTTPProberWithClient(&http.Client{Transport: transport})
+}
+
+// NewHTTPProberWithClient creates a prober sending probes with the given client
+func NewHTTPProberWithClient(client *http.Client) *HTTPProber {
+	return &HTTPProber{client: client}
+}
+
+// Probe fetches the probe endpoint of the server
+func (p *HTTPProber) Probe(ctx context.Context, server string) (*ProbeInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/probe", server), nil)
+	if err != nil {
+		return nil, fmt.Errorf("probe failed: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("probe failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("probe failed: %s", resp.Status)
+	}
+	return DecodeProbe(resp.Body, server)
+}
+
+// DecodeProbe decodes a JSON encoded probe response received from server
+func DecodeProbe(r io.Reader, server string) (*ProbeInfo, error) {
+	var probeResp struct {
+		RIF           uint64                   `json:"rif"`
+		Latency       time.Duration            `json:"latency"`
+		PathLatencies map[string]time.Duration `json:"path_latencies"`
+		Draining      bool                     `json:"draining"`
+	}
+	if err := json.NewDecoder(r).Decode(&probeResp); err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+
+	return &ProbeInfo{
+		RIF:          probeResp.RIF,
+		Latency:      probeResp.Latency,
+		ServerID:     server,
+		Timestamp:    time.Now(),
+		UseCount:     0,
+		JobLatencies: probeResp.PathLatencies,
+		Draining:     probeResp.Draining,
+	}, nil
+}
+
+// probeFailed records a failed probe and drops the server's probes from the
+// pool, so the selector stops acting on load signals the replica can no
+// longer confirm. The failure also counts towards marking the server
+// unhealthy. Callers must hold c.mu.
+func (c *Client) probeFailed(server string, err error) {
+	reason := "error"
+	if errors.Is(err, context.DeadlineExceeded) {
+		reason = "timeout"
+	}
+	metrics.IncrementProbeFailure(server, reason)
+	c.logger.Printf("Probe of %s failed: %v", server, err)
+
+	c.purgeProbes(server)
+	c.recordFailure(server)
+}
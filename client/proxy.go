@@ -0,0 +1,57 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+)
+
+// Proxy is an HTTP reverse proxy that forwards every request to a replica
+// picked by the client's selector. Method, headers, body and the original
+// Host header are preserved, and responses are streamed back as they arrive.
+type Proxy struct {
+	// Transport picks the replica and sends the request
+	Transport *Transport
+
+	proxy  *httputil.ReverseProxy
+	logger *log.Logger
+}
+
+// NewProxy creates a reverse proxy load balancing over the client's replicas
+func NewProxy(c *Client) *Proxy {
+	p := &Proxy{
+		Transport: NewTransport(c),
+		logger:    log.New(os.Stdout, "[Proxy] ", log.LstdFlags),
+	}
+	p.Transport.PreserveHost = true
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			// The transport replaces the host with the selected replica
+			pr.SetURL(&url.URL{Scheme: "http", Host: pr.In.Host})
+			pr.SetXForwarded()
+			pr.Out.Host = pr.In.Host
+		},
+		Transport: p.Transport,
+		// Flush immediately so streaming responses are not buffered
+		FlushInterval: -1,
+		ErrorHandler:  p.handleError,
+	}
+	return p
+}
+
+// ServeHTTP forwards the request to a replica
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	p.logger.Printf("Proxying %s failed: %v", r.URL.Path, err)
+	if errors.Is(err, ErrNoReplica) {
+		http.Error(w, "no replica available", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusBadGateway)
+}
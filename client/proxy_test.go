@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyForwardsRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Custom", r.Header.Get("X-Custom"))
+		w.Header().Set("X-Host", r.Host)
+		w.Write(body)
+	}))
+	defer backend.Close()
+
+	c := NewClient(Config{ProbeRate: 1}, []string{serverAddr(backend)}, ModeRoundRobin)
+	defer c.Stop()
+	proxy := httptest.NewServer(NewProxy(c))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, proxy.URL+"/items/1", strings.NewReader("payload"))
+	req.Header.Set("X-Custom", "value")
+	req.Host = "service.local"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	expected := map[string]string{
+		"X-Method": http.MethodPut,
+		"X-Path":   "/items/1",
+		"X-Custom": "value",
+		"X-Host":   "service.local",
+	}
+	for header, value := range expected {
+		if got := resp.Header.Get(header); got != value {
+			t.Errorf("Expected %s %v, got %v", header, value, got)
+		}
+	}
+	if string(body) != "payload" {
+		t.Errorf("Expected body payload, got %v", string(body))
+	}
+}
+
+func TestProxyStreamsResponses(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	c := NewClient(Config{ProbeRate: 1}, []string{serverAddr(backend)}, ModeRoundRobin)
+	defer c.Stop()
+	proxy := httptest.NewServer(NewProxy(c))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/stream")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		lines <- line
+	}()
+	select {
+	case line := <-lines:
+		if line != "first\n" {
+			t.Errorf("Expected first chunk, got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("First chunk was not streamed before the response completed")
+	}
+}
+
+func TestProxyWithoutReplicas(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1}, nil, ModeHCL)
+	defer c.Stop()
+	proxy := httptest.NewServer(NewProxy(c))
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/ping")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %v", resp.Status)
+	}
+}
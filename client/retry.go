@@ -0,0 +1,101 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// RetryPolicy configures how failed requests are retried on another
+// replica. Retries are opt-in: the zero value never retries. Only
+// idempotent requests are retried, and retries draw from a token bucket
+// filled by regular requests, so they cannot amplify an overload.
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"max_attempts"`    // Attempts per request including the first, 0 or 1 disables retries
+	IdempotentJobs []string `json:"idempotent_jobs"` // Jobs safe to retry regardless of their method
+	BudgetRatio    float64  `json:"budget_ratio"`    // Retry tokens earned per request (default 0.1)
+	BudgetBurst    int      `json:"budget_burst"`    // Maximum number of retry tokens (default 10)
+}
+
+// enabled reports whether the policy allows any retries
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+// idempotent reports whether the request may be sent more than once. GET,
+// HEAD, OPTIONS and TRACE requests and requests carrying an
+// Idempotency-Key header are, like in net/http; other requests only if
+// their job is listed in IdempotentJobs.
+func (p RetryPolicy) idempotent(job string, req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	return slices.Contains(p.IdempotentJobs, job)
+}
+
+// retryable reports whether an attempt failed in a way another replica
+// might not, i.e. with a transport error or a 5xx response
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !Outcome{Err: err}.Cancelled()
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// rewindable reports whether the request body can be sent again
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// discard drains and closes the body of a response that is being retried,
+// so its connection can be reused
+func discard(resp *http.Response) {
+	if resp != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// retryBudget is a token bucket limiting retries to a share of the
+// requests sent
+type retryBudget struct {
+	tokens float64
+	mu     sync.Mutex
+}
+
+// deposit adds the tokens earned by a request
+func (b *retryBudget) deposit(policy RetryPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+policy.BudgetRatio, float64(policy.BudgetBurst))
+}
+
+// withdraw takes a token for a retry, reporting false if there is none
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund gives back the token of a retry that was not sent
+func (b *retryBudget) refund(policy RetryPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+1, float64(policy.BudgetBurst))
+}
+
+// requestPolicies returns the client's current retry and hedge policies
+func (c *Client) requestPolicies() (RetryPolicy, HedgePolicy) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config.Retry, c.config.Hedge
+}
@@ -0,0 +1,171 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer starts a replica that always answers with status and
+// counts the requests it receives
+func newFlakyServer(t *testing.T, status int, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newRetryTestClient(t *testing.T, servers []string, policy RetryPolicy) *Client {
+	t.Helper()
+	c := NewClient(Config{ProbeRate: 1, Retry: policy}, servers, ModeRoundRobin)
+	t.Cleanup(c.Stop)
+	return c
+}
+
+func TestRetryOnAnotherReplica(t *testing.T) {
+	var badHits, goodHits atomic.Int32
+	bad := newFlakyServer(t, http.StatusServiceUnavailable, &badHits)
+	good := newFlakyServer(t, http.StatusOK, &goodHits)
+	c := newRetryTestClient(t, []string{serverAddr(bad), serverAddr(good)}, RetryPolicy{
+		MaxAttempts:    2,
+		IdempotentJobs: []string{"/batch"},
+	})
+
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "/batch", strings.NewReader("payload"))
+		resp, err := c.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || string(body) != "payload" {
+			t.Errorf("Expected the retry to succeed with the original body, got %d %q", resp.StatusCode, body)
+		}
+	}
+	if goodHits.Load() != 4 {
+		t.Errorf("Expected every request to reach the good replica, got %d", goodHits.Load())
+	}
+}
+
+func TestRetryHonorsIdempotency(t *testing.T) {
+	var hits atomic.Int32
+	bad := newFlakyServer(t, http.StatusInternalServerError, &hits)
+	c := newRetryTestClient(t, []string{serverAddr(bad)}, RetryPolicy{MaxAttempts: 3})
+
+	req, _ := http.NewRequest(http.MethodPost, "/medium", nil)
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 1 {
+		t.Errorf("Expected non-idempotent request to be sent once, got %d", hits.Load())
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/ping", nil)
+	resp, err = c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if hits.Load() != 4 {
+		t.Errorf("Expected GET to be attempted 3 times, got %d", hits.Load()-1)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	var hits atomic.Int32
+	bad := newFlakyServer(t, http.StatusInternalServerError, &hits)
+	c := newRetryTestClient(t, []string{serverAddr(bad)}, RetryPolicy{
+		MaxAttempts: 2,
+		BudgetRatio: 0.01,
+		BudgetBurst: 2,
+	})
+
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+		resp, err := c.Do(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	// 10 requests plus the 2 retries the burst allows
+	if hits.Load() != 12 {
+		t.Errorf("Expected retries to stop once the budget ran out, got %d attempts", hits.Load())
+	}
+}
+
+func TestRetryExcludesTriedReplicaWithHCL(t *testing.T) {
+	var badHits, goodHits atomic.Int32
+	bad := newFlakyServer(t, http.StatusServiceUnavailable, &badHits)
+	good := newFlakyServer(t, http.StatusOK, &goodHits)
+	c := NewClient(Config{ProbeRate: 1, QRIFThreshold: 0.75, Retry: RetryPolicy{MaxAttempts: 2}},
+		[]string{serverAddr(bad), serverAddr(good)}, ModeHCL)
+	c.Stop()
+	// HCL prefers the bad replica, the retry must go to the other one
+	c.probes = []ProbeInfo{
+		{ServerID: serverAddr(bad), RIF: 1, NormalizedRIF: 0.1, Timestamp: time.Now()},
+		{ServerID: serverAddr(good), RIF: 5, NormalizedRIF: 0.5, Timestamp: time.Now()},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || badHits.Load() != 1 || goodHits.Load() != 1 {
+		t.Errorf("Expected one attempt on each replica ending in 200, got %d with %d bad and %d good hits",
+			resp.StatusCode, badHits.Load(), goodHits.Load())
+	}
+}
+
+// onceSelector selects its server once and then has nothing to select
+type onceSelector struct {
+	server string
+	done   bool
+}
+
+func (s *onceSelector) Select(pool *ProbePool, job string) (string, error) {
+	if s.done {
+		return "", errors.New("no probes available")
+	}
+	s.done = true
+	return s.server, nil
+}
+
+func TestRetryKeepsResponseWithoutReplica(t *testing.T) {
+	var hits atomic.Int32
+	bad := newFlakyServer(t, http.StatusServiceUnavailable, &hits)
+	c := NewClient(Config{ProbeRate: 1, Retry: RetryPolicy{MaxAttempts: 3}},
+		[]string{serverAddr(bad)}, ModeHCL, WithSelector(&onceSelector{server: serverAddr(bad)}), WithProber(okProber{}))
+	c.Stop()
+	tokens := c.retryBudget.tokens
+
+	req, _ := http.NewRequest(http.MethodGet, "/ping", strings.NewReader("payload"))
+	resp, err := c.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Expected the failed attempt's response, got %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || string(body) != "payload" {
+		t.Errorf("Expected the 503 of the only attempt, got %d %q", resp.StatusCode, body)
+	}
+	if c.retryBudget.tokens < tokens {
+		t.Errorf("Expected the unsent retry to give back its token, got %v of %v", c.retryBudget.tokens, tokens)
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"fmt"
+	"go-prequel/metrics"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProbePool is the view of the client's probe state handed to a Selector
+type ProbePool struct {
+	Probes        []ProbeInfo // Probes currently held by the client
+	Servers       []string    // Servers currently in the server pool
+	QRIFThreshold float64     // Q_RIF threshold to determine hot/cold
+}
+
+// IsHot determines if a probe represents a hot server
+func (p *ProbePool) IsHot(probe ProbeInfo) bool {
+	return probe.NormalizedRIF >= p.QRIFThreshold
+}
+
+// Selector picks a replica for a job out of the probe pool.
+// The client serializes calls to Select, so implementations do not need
+// to guard their own state. The pool must be treated as read-only.
+type Selector interface {
+	Select(pool *ProbePool, job string) (string, error)
+}
+
+// MembershipListener is implemented by selectors that keep per-server state
+// and need to know when the server pool changes. The client calls
+// ServersChanged with the new pool, serialized with calls to Select.
+type MembershipListener interface {
+	ServersChanged(servers []string)
+}
+
+// SelectorFactory creates a new Selector instance for a client
+type SelectorFactory func() Selector
+
+var (
+	selectorsMu sync.RWMutex
+	selectors   = map[SelectionMode]SelectorFactory{}
+)
+
+// RegisterSelector makes a selection policy available under the given mode.
+// Registering the same mode twice replaces the earlier factory.
+func RegisterSelector(mode SelectionMode, factory SelectorFactory) {
+	selectorsMu.Lock()
+	defer selectorsMu.Unlock()
+	selectors[mode] = factory
+}
+
+// NewSelector creates a Selector for a registered mode
+func NewSelector(mode SelectionMode) (Selector, error) {
+	selectorsMu.RLock()
+	defer selectorsMu.RUnlock()
+
+	factory, ok := selectors[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown selection mode: %s", mode)
+	}
+	return factory(), nil
+}
+
+// SelectionModes returns the names of all registered selection modes
+func SelectionModes() []string {
+	selectorsMu.RLock()
+	defer selectorsMu.RUnlock()
+
+	modes := make([]string, 0, len(selectors))
+	for mode := range selectors {
+		modes = append(modes, string(mode))
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+func init() {
+	RegisterSelector(ModeHCL, func() Selector { return &HCLSelector{} })
+	RegisterSelector(ModeRoundRobin, func() Selector { return &RoundRobinSelector{} })
+}
+
+// HCLSelector implements the Hot Cold Lexicographic rule from the paper
+type HCLSelector struct{}
+
+// Select picks the cold probe with the lowest RIF, or the hot probe with the
+// lowest latency for the job if every probe is hot
+func (s *HCLSelector) Select(pool *ProbePool, job string) (string, error) {
+	if len(pool.Probes) == 0 {
+		return "", fmt.Errorf("no probes available")
+	}
+
+	// Single pass over the pool tracking the best cold and hot probes
+	coldIndex, hotIndex := -1, -1
+	var hotLatency time.Duration
+	for i := range pool.Probes {
+		probe := &pool.Probes[i]
+		if pool.IsHot(*probe) {
+			if latency := probe.JobLatency(job); hotIndex < 0 || latency < hotLatency {
+				hotIndex, hotLatency = i, latency
+			}
+		} else if coldIndex < 0 || probe.RIF < pool.Probes[coldIndex].RIF {
+			coldIndex = i
+		}
+	}
+
+	if coldIndex >= 0 {
+		server := pool.Probes[coldIndex].ServerID
+		metrics.IncrementProbeSelection("cold", server)
+		return server, nil
+	}
+
+	server := pool.Probes[hotIndex].ServerID
+	metrics.IncrementProbeSelection("hot", server)
+	return server, nil
+}
+
+// RoundRobinSelector cycles through the server pool ignoring probes
+type RoundRobinSelector struct {
+	index int
+	last  string
+}
+
+// Select returns the next server in the pool
+func (s *RoundRobinSelector) Select(pool *ProbePool, job string) (string, error) {
+	if len(pool.Servers) == 0 {
+		return "", fmt.Errorf("no servers available")
+	}
+
+	s.index %= len(pool.Servers)
+	server := pool.Servers[s.index]
+	s.index = (s.index + 1) % len(pool.Servers)
+	s.last = server
+
+	metrics.IncrementProbeSelection("round_robin", server)
+	return server, nil
+}
+
+// ServersChanged keeps the rotation going from the last selected server if it
+// is still in the pool, otherwise it restarts from the beginning
+func (s *RoundRobinSelector) ServersChanged(servers []string) {
+	s.index = 0
+	for i, server := range servers {
+		if server == s.last {
+			s.index = (i + 1) % len(servers)
+			return
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-prequel/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHCLSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		probes   []ProbeInfo
+		expected string
+	}{
+		{
+			name: "cold probe with lowest RIF wins",
+			probes: []ProbeInfo{
+				{ServerID: "a", RIF: 4, NormalizedRIF: 0.5, Latency: time.Millisecond},
+				{ServerID: "b", RIF: 2, NormalizedRIF: 0.25, Latency: time.Second},
+				{ServerID: "c", RIF: 8, NormalizedRIF: 1, Latency: time.Microsecond},
+			},
+			expected: "b",
+		},
+		{
+			name: "all hot picks lowest latency",
+			probes: []ProbeInfo{
+				{ServerID: "a", RIF: 8, NormalizedRIF: 1, Latency: 3 * time.Millisecond},
+				{ServerID: "b", RIF: 7, NormalizedRIF: 0.9, Latency: time.Millisecond},
+			},
+			expected: "b",
+		},
+		{
+			name: "all hot compares the latency of the job",
+			probes: []ProbeInfo{
+				{ServerID: "a", RIF: 8, NormalizedRIF: 1, Latency: 3 * time.Second,
+					JobLatencies: map[string]time.Duration{"/ping": time.Millisecond}},
+				{ServerID: "b", RIF: 7, NormalizedRIF: 0.9, Latency: time.Second,
+					JobLatencies: map[string]time.Duration{"/ping": 2 * time.Millisecond}},
+			},
+			expected: "a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool := &ProbePool{Probes: test.probes, QRIFThreshold: 0.75}
+			server, err := (&HCLSelector{}).Select(pool, "/ping")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if server != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, server)
+			}
+		})
+	}
+
+	if _, err := (&HCLSelector{}).Select(&ProbePool{}, "ping"); err == nil {
+		t.Errorf("Expected error for empty probe pool")
+	}
+}
+
+func TestRoundRobinSelector(t *testing.T) {
+	pool := &ProbePool{Servers: []string{"a", "b", "c"}}
+	selector := &RoundRobinSelector{}
+
+	for _, expected := range []string{"a", "b", "c", "a"} {
+		server, err := selector.Select(pool, "ping")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if server != expected {
+			t.Errorf("Expected %v, got %v", expected, server)
+		}
+	}
+}
+
+type fixedSelector struct{ server string }
+
+func (s *fixedSelector) Select(pool *ProbePool, job string) (string, error) {
+	return s.server, nil
+}
+
+func TestRegisterSelector(t *testing.T) {
+	mode := SelectionMode("fixed")
+	RegisterSelector(mode, func() Selector { return &fixedSelector{server: "a"} })
+
+	selector, err := NewSelector(mode)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if server, _ := selector.Select(&ProbePool{}, "ping"); server != "a" {
+		t.Errorf("Expected a, got %v", server)
+	}
+
+	if _, err := NewSelector("unknown"); err == nil {
+		t.Errorf("Expected error for unknown mode")
+	}
+}
+
+// serverProbe serves a request for each path through a server-side tracker,
+// taking the given time, and decodes the tracker's probe as a client would
+func serverProbe(t *testing.T, id string, latencies map[string]time.Duration) *ProbeInfo {
+	t.Helper()
+	tracker := server.NewTracker()
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latencies[r.URL.Path])
+	}))
+	for path := range latencies {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	data, err := json.Marshal(tracker.Probe())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	probe, err := DecodeProbe(bytes.NewReader(data), id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	probe.NormalizedRIF = 1
+	return probe
+}
+
+func TestHCLSelectorWithServerProbes(t *testing.T) {
+	a := serverProbe(t, "a", map[string]time.Duration{"/ping": 0, "/batch": 50 * time.Millisecond})
+	b := serverProbe(t, "b", map[string]time.Duration{"/ping": 50 * time.Millisecond, "/batch": 0})
+	pool := &ProbePool{Probes: []ProbeInfo{*a, *b}, QRIFThreshold: 0.75}
+
+	for job, expected := range map[string]string{"/ping": "a", "ping": "a", "/batch": "b", "batch": "b"} {
+		server, err := (&HCLSelector{}).Select(pool, job)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if server != expected {
+			t.Errorf("%s: expected %v, got %v", job, expected, server)
+		}
+	}
+}
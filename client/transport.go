@@ -0,0 +1,166 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"go-prequel/metrics"
+	"net/http"
+	"slices"
+)
+
+// ErrNoReplica is returned when the selector cannot pick a replica
+var ErrNoReplica = errors.New("no replica available")
+
+// OtherJob is the job of requests whose path is not a configured job
+const OtherJob = "other"
+
+// Transport is an http.RoundTripper that sends every request to a replica
+// picked by the client's selector, rewriting the request host to the
+// replica's address. Swapping it into an http.Client gives that client
+// Prequal load balancing.
+type Transport struct {
+	client *Client
+
+	// Base sends the rewritten requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+
+	// Job maps a request to the job name passed to SelectReplica. The job
+	// is used as a metric label, so it must have few distinct values.
+	// Defaults to the request path if the client's config lists it as a job,
+	// and to OtherJob for any other path.
+	Job func(r *http.Request) string
+
+	// PreserveHost keeps the request's Host header instead of setting it
+	// to the replica's address
+	PreserveHost bool
+}
+
+// NewTransport creates a Transport load balancing over the client's replicas
+func NewTransport(c *Client) *Transport {
+	return &Transport{client: c}
+}
+
+// RoundTrip selects a replica, sends the request to it and reports the
+// outcome back to the client. The request context bounds both the selection
+// and the request. Idempotent requests are hedged and failed ones retried on
+// other replicas as allowed by the client's hedge and retry policies.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.send(req, t.job(req))
+}
+
+// job returns the job of the request
+func (t *Transport) job(req *http.Request) string {
+	if t.Job != nil {
+		return t.Job(req)
+	}
+	if t.client.knownJob(req.URL.Path) {
+		return req.URL.Path
+	}
+	return OtherJob
+}
+
+// send is RoundTrip for a request of the given job
+func (t *Transport) send(req *http.Request, job string) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	policy, hedgePolicy := t.client.requestPolicies()
+	idempotent := policy.idempotent(job, req) && rewindable(req)
+	retries := policy.enabled() && idempotent
+	hedges := hedgePolicy.hedges(job) && idempotent
+	if policy.enabled() {
+		t.client.retryBudget.deposit(policy)
+	}
+
+	server, err := t.client.selectReplicaContext(req.Context(), job, nil)
+	if err != nil {
+		closeBody(req)
+		return nil, fmt.Errorf("%w: %v", ErrNoReplica, err)
+	}
+
+	var tried map[string]bool
+	for attempt := 1; ; attempt++ {
+		var resp *http.Response
+		var hedgeServer string
+		if hedges {
+			resp, hedgeServer, err = t.hedge(base, req, server, job, tried, hedgePolicy, attempt > 1)
+		} else {
+			var out *http.Request
+			if out, err = t.outgoing(req, server, attempt > 1); err != nil {
+				closeBody(req)
+				return nil, err
+			}
+			resp, err = t.client.roundTrip(base, out, server, job)
+		}
+		if !retries || attempt >= policy.MaxAttempts || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if !t.client.retryBudget.withdraw() {
+			metrics.IncrementRetry(job, "budget_exhausted")
+			return resp, err
+		}
+
+		if tried == nil {
+			tried = make(map[string]bool, policy.MaxAttempts)
+		}
+		tried[server] = true
+		if hedgeServer != "" {
+			tried[hedgeServer] = true
+		}
+
+		// The failed attempt is only dropped once there is a replica to
+		// retry on, otherwise the caller gets its response or error
+		next, selectErr := t.client.selectReplicaContext(req.Context(), job, tried)
+		if selectErr != nil {
+			t.client.retryBudget.refund(policy)
+			metrics.IncrementRetry(job, "no_replica")
+			return resp, err
+		}
+		metrics.IncrementRetry(job, "retried")
+		discard(resp)
+		server = next
+	}
+}
+
+// outgoing returns the request to send to server. rewind replaces the body
+// with a fresh copy, for requests sent more than once.
+func (t *Transport) outgoing(req *http.Request, server string, rewind bool) (*http.Request, error) {
+	// A RoundTripper must not modify the caller's request
+	out := req.Clone(req.Context())
+	out.URL.Host = server
+	if out.URL.Scheme == "" {
+		out.URL.Scheme = "http"
+	}
+	if !t.PreserveHost {
+		out.Host = server
+	}
+	setDeadline(req.Context(), out)
+	if rewind && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		out.Body = body
+	}
+	return out, nil
+}
+
+// closeBody closes the body of a request that will not be sent, as a
+// RoundTripper must
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// knownJob reports whether the client's config names the path as a job,
+// either in its jobs or in its retry and hedge policies
+func (c *Client) knownJob(path string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return slices.Contains(c.config.Jobs, path) ||
+		slices.Contains(c.config.Retry.IdempotentJobs, path) ||
+		slices.Contains(c.config.Hedge.Jobs, path)
+}
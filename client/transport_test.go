@@ -0,0 +1,70 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransportRewritesHost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+r.URL.Path)
+	}))
+	defer backend.Close()
+
+	c := NewClient(Config{ProbeRate: 1}, []string{serverAddr(backend)}, ModeRoundRobin)
+	defer c.Stop()
+	httpClient := &http.Client{Transport: NewTransport(c)}
+
+	resp, err := httpClient.Get("http://my-service/hello")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if expected := serverAddr(backend) + "/hello"; string(body) != expected {
+		t.Errorf("Expected %v, got %v", expected, string(body))
+	}
+}
+
+func TestTransportWithoutReplicas(t *testing.T) {
+	c := NewClient(Config{ProbeRate: 1}, nil, ModeHCL)
+	defer c.Stop()
+	httpClient := &http.Client{Transport: NewTransport(c)}
+
+	_, err := httpClient.Get("http://my-service/hello")
+	if !errors.Is(err, ErrNoReplica) {
+		t.Errorf("Expected ErrNoReplica, got %v", err)
+	}
+}
+
+func TestTransportJob(t *testing.T) {
+	c := NewClient(Config{
+		ProbeRate: 1,
+		Jobs:      []string{"/orders"},
+		Hedge:     HedgePolicy{Jobs: []string{"/ping"}},
+	}, []string{"a"}, ModeHCL)
+	defer c.Stop()
+	transport := NewTransport(c)
+
+	tests := map[string]string{
+		"/orders":    "/orders",
+		"/ping":      "/ping",
+		"/orders/42": OtherJob,
+	}
+	for path, expected := range tests {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		if job := transport.job(req); job != expected {
+			t.Errorf("Expected job %q for %s, got %q", expected, path, job)
+		}
+	}
+
+	transport.Job = func(r *http.Request) string { return "orders" }
+	req, _ := http.NewRequest(http.MethodGet, "/orders/42", nil)
+	if job := transport.job(req); job != "orders" {
+		t.Errorf("Expected the Job func to decide, got %q", job)
+	}
+}
@@ -0,0 +1,193 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"go-prequel/client"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SchemeDNS resolves A/AAAA records, e.g. dns:///svc.local:8081
+	SchemeDNS = "dns"
+	// SchemeSRV resolves SRV records, e.g. srv:///_prequal._tcp.svc.local
+	SchemeSRV = "srv"
+)
+
+// Resolver looks up DNS records. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// IsDNSTarget reports whether the target needs to be resolved through DNS
+func IsDNSTarget(target string) bool {
+	return strings.HasPrefix(target, SchemeDNS+"://") || strings.HasPrefix(target, SchemeSRV+"://")
+}
+
+// Resolve expands DNS targets into host:port addresses. Targets without a
+// scheme are passed through unchanged. The result is sorted and free of
+// duplicates so repeated resolutions can be compared.
+func Resolve(ctx context.Context, resolver Resolver, targets []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var servers []string
+	for _, target := range targets {
+		addrs, err := resolveTarget(ctx, resolver, target)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			if !seen[addr] {
+				seen[addr] = true
+				servers = append(servers, addr)
+			}
+		}
+	}
+	sort.Strings(servers)
+	return servers, nil
+}
+
+func resolveTarget(ctx context.Context, resolver Resolver, target string) ([]string, error) {
+	scheme, name, ok := strings.Cut(target, "://")
+	if !ok {
+		return []string{target}, nil
+	}
+
+	// Only the default authority is supported, i.e. dns:///name
+	authority, name, _ := strings.Cut(name, "/")
+	if authority != "" {
+		return nil, fmt.Errorf("target %q: custom DNS authority not supported", target)
+	}
+
+	switch scheme {
+	case SchemeDNS:
+		host, port, err := net.SplitHostPort(name)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", target, err)
+		}
+		ips, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %q: %w", target, err)
+		}
+		addrs := make([]string, len(ips))
+		for i, ip := range ips {
+			addrs[i] = net.JoinHostPort(ip, port)
+		}
+		return addrs, nil
+	case SchemeSRV:
+		_, records, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %q: %w", target, err)
+		}
+		addrs := make([]string, len(records))
+		for i, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			addrs[i] = net.JoinHostPort(host, strconv.Itoa(int(record.Port)))
+		}
+		return addrs, nil
+	default:
+		return nil, fmt.Errorf("target %q: unknown scheme %q", target, scheme)
+	}
+}
+
+// DNSWatcher periodically re-resolves a set of targets and applies the
+// result to a client's server pool. Failed or empty resolutions keep the
+// previous pool.
+type DNSWatcher struct {
+	client   *client.Client
+	resolver Resolver
+	targets  []string
+	interval time.Duration
+	timeout  time.Duration
+
+	last []string
+	mu   sync.Mutex
+
+	done   chan struct{}
+	logger *log.Logger
+}
+
+// NewDNSWatcher creates a watcher for the given targets. A nil resolver
+// uses net.DefaultResolver.
+func NewDNSWatcher(c *client.Client, resolver Resolver, targets []string, interval time.Duration) *DNSWatcher {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &DNSWatcher{
+		client:   c,
+		resolver: resolver,
+		targets:  targets,
+		interval: interval,
+		timeout:  interval,
+		done:     make(chan struct{}),
+		logger:   log.New(os.Stdout, "[Discovery] ", log.LstdFlags),
+	}
+}
+
+// Start re-resolves the targets on every interval until Stop is called
+func (w *DNSWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+				if err := w.Refresh(ctx); err != nil {
+					w.logger.Printf("Keeping last resolved servers: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop stops re-resolving
+func (w *DNSWatcher) Stop() {
+	close(w.done)
+}
+
+// Refresh resolves the targets and updates the client if the result changed
+func (w *DNSWatcher) Refresh(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	servers, err := Resolve(ctx, w.resolver, w.targets)
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return fmt.Errorf("no addresses resolved")
+	}
+	if equalServers(servers, w.last) {
+		return nil
+	}
+
+	if err := w.client.SetServers(servers); err != nil {
+		return err
+	}
+	w.last = servers
+	w.logger.Printf("Resolved %d servers", len(servers))
+	return nil
+}
+
+func equalServers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver serves DNS records from memory
+type fakeResolver struct {
+	mu    sync.Mutex
+	hosts map[string][]string
+	srvs  map[string][]*net.SRV
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return addrs, nil
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records, ok := r.srvs[name]
+	if !ok {
+		return "", nil, fmt.Errorf("no such host %s", name)
+	}
+	return name, records, nil
+}
+
+func (r *fakeResolver) setHosts(host string, addrs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts[host] = addrs
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		hosts: map[string][]string{
+			"svc.local": {"10.0.0.2", "10.0.0.1"},
+		},
+		srvs: map[string][]*net.SRV{
+			"_prequal._tcp.svc.local": {
+				{Target: "a.svc.local.", Port: 8081},
+				{Target: "b.svc.local.", Port: 8082},
+			},
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		targets  []string
+		expected []string
+		wantErr  bool
+	}{
+		{[]string{"dns:///svc.local:8081"}, []string{"10.0.0.1:8081", "10.0.0.2:8081"}, false},
+		{[]string{"srv:///_prequal._tcp.svc.local"}, []string{"a.svc.local:8081", "b.svc.local:8082"}, false},
+		{[]string{"localhost:8083", "dns:///svc.local:8081", "10.0.0.1:8081"}, []string{"10.0.0.1:8081", "10.0.0.2:8081", "localhost:8083"}, false},
+		{[]string{"dns:///svc.local"}, nil, true},
+		{[]string{"dns:///missing.local:8081"}, nil, true},
+		{[]string{"dns://8.8.8.8/svc.local:8081"}, nil, true},
+		{[]string{"xds:///svc.local"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Resolving %v", test.targets), func(t *testing.T) {
+			servers, err := Resolve(context.Background(), newFakeResolver(), test.targets)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %v", servers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(servers, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, servers)
+			}
+		})
+	}
+}
+
+func TestDNSWatcherRefresh(t *testing.T) {
+	resolver := newFakeResolver()
+	c := newTestClient(t, []string{"10.0.0.1:8081"})
+	w := NewDNSWatcher(c, resolver, []string{"dns:///svc.local:8081"}, time.Second)
+
+	if err := w.Refresh(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if servers := c.Servers(); !reflect.DeepEqual(servers, []string{"10.0.0.1:8081", "10.0.0.2:8081"}) {
+		t.Errorf("Unexpected servers %v", servers)
+	}
+
+	resolver.setHosts("svc.local", "10.0.0.3")
+	if err := w.Refresh(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if servers := c.Servers(); !reflect.DeepEqual(servers, []string{"10.0.0.3:8081"}) {
+		t.Errorf("Unexpected servers %v", servers)
+	}
+
+	// Empty resolutions keep the previous pool
+	resolver.setHosts("svc.local")
+	if err := w.Refresh(context.Background()); err == nil {
+		t.Errorf("Expected error for empty resolution")
+	}
+	if servers := c.Servers(); !reflect.DeepEqual(servers, []string{"10.0.0.3:8081"}) {
+		t.Errorf("Expected servers to be unchanged, got %v", servers)
+	}
+}
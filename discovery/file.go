@@ -0,0 +1,181 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-prequel/client"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// TargetGroup is a group of targets in the Prometheus file_sd format.
+// Labels are accepted for compatibility but not used by the client.
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// FileWatcher polls a client config file and an optional targets file and
+// applies changes to a running client. Bad input is logged and ignored, so
+// the client keeps running with the last good configuration.
+type FileWatcher struct {
+	client      *client.Client
+	configPath  string // client config, tunables and servers (optional)
+	targetsPath string // file_sd style targets, overrides config servers (optional)
+	interval    time.Duration
+
+	// Last applied file contents
+	lastConfig  []byte
+	lastTargets []byte
+	mu          sync.Mutex
+
+	done   chan struct{}
+	logger *log.Logger
+}
+
+// NewFileWatcher creates a watcher for the given files. Either path may be
+// empty, but not both.
+func NewFileWatcher(c *client.Client, configPath, targetsPath string, interval time.Duration) *FileWatcher {
+	return &FileWatcher{
+		client:      c,
+		configPath:  configPath,
+		targetsPath: targetsPath,
+		interval:    interval,
+		done:        make(chan struct{}),
+		logger:      log.New(os.Stdout, "[Discovery] ", log.LstdFlags),
+	}
+}
+
+// Start reloads the files on every interval until Stop is called
+func (w *FileWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				if err := w.Reload(); err != nil {
+					w.logger.Printf("Keeping last good config: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops watching
+func (w *FileWatcher) Stop() {
+	close(w.done)
+}
+
+// Reload reads the watched files and applies them to the client if they
+// changed since the last successful reload
+func (w *FileWatcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.configPath == "" && w.targetsPath == "" {
+		return fmt.Errorf("no files to watch")
+	}
+
+	var configData, targetsData []byte
+	var err error
+	if w.configPath != "" {
+		if configData, err = os.ReadFile(w.configPath); err != nil {
+			return fmt.Errorf("read config: %w", err)
+		}
+	}
+	if w.targetsPath != "" {
+		if targetsData, err = os.ReadFile(w.targetsPath); err != nil {
+			return fmt.Errorf("read targets: %w", err)
+		}
+	}
+	if bytes.Equal(configData, w.lastConfig) && bytes.Equal(targetsData, w.lastTargets) {
+		return nil
+	}
+
+	// Validate everything before touching the client
+	config := w.client.Config()
+	if configData != nil {
+		config = client.Config{}
+		if err := json.Unmarshal(configData, &config); err != nil {
+			return fmt.Errorf("decode config: %w", err)
+		}
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("invalid config: %w", err)
+		}
+	}
+
+	// Servers come from the targets file if there is one, otherwise from
+	// the config file if it lists any
+	var servers []string
+	if targetsData != nil {
+		if servers, err = ParseTargets(targetsData); err != nil {
+			return err
+		}
+	} else {
+		servers = config.Servers
+	}
+	setServers := targetsData != nil || len(servers) > 0
+	if setServers {
+		if err := ValidateTargets(servers); err != nil {
+			return err
+		}
+	}
+
+	if configData != nil {
+		if err := w.client.UpdateConfig(config); err != nil {
+			return fmt.Errorf("apply config: %w", err)
+		}
+	}
+	// ValidateTargets already rejected every list SetServers would refuse
+	if setServers {
+		if err := w.client.SetServers(servers); err != nil {
+			return fmt.Errorf("apply servers: %w", err)
+		}
+	}
+
+	w.lastConfig = configData
+	w.lastTargets = targetsData
+	w.logger.Printf("Applied config with %d servers", len(w.client.Servers()))
+	return nil
+}
+
+// ParseTargets decodes a targets file, either a file_sd list of target
+// groups or a plain JSON list of addresses
+func ParseTargets(data []byte) ([]string, error) {
+	var groups []TargetGroup
+	if err := json.Unmarshal(data, &groups); err == nil {
+		var servers []string
+		for _, group := range groups {
+			servers = append(servers, group.Targets...)
+		}
+		return servers, nil
+	}
+
+	var servers []string
+	if err := json.Unmarshal(data, &servers); err != nil {
+		return nil, fmt.Errorf("decode targets: %w", err)
+	}
+	return servers, nil
+}
+
+// ValidateTargets checks that the target list is non-empty and made of
+// host:port addresses. An empty list is treated as bad input, since it is
+// more likely a truncated write than an intent to drain every replica.
+func ValidateTargets(servers []string) error {
+	if len(servers) == 0 {
+		return fmt.Errorf("no targets")
+	}
+	for _, server := range servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return fmt.Errorf("invalid target %q: %w", server, err)
+		}
+	}
+	return nil
+}
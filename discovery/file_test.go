@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"go-prequel/client"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, servers []string) *client.Client {
+	t.Helper()
+	c := client.NewClient(client.Config{ProbeRate: 1, QRIFThreshold: 0.75}, servers, client.ModeHCL)
+	c.Stop()
+	return c
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestFileWatcherConfig(t *testing.T) {
+	c := newTestClient(t, []string{"localhost:8081"})
+	path := filepath.Join(t.TempDir(), "config.json")
+	w := NewFileWatcher(c, path, "", time.Second)
+
+	writeFile(t, path, `{"probe_rate": 2, "q_rif_threshold": 0.5, "max_probe_age": 1000000000,
+		"servers": ["localhost:8081", "localhost:8082"]}`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config := c.Config()
+	if config.QRIFThreshold != 0.5 || config.MaxProbeAge != time.Second {
+		t.Errorf("Expected tunables to be applied, got %+v", config)
+	}
+	if servers := c.Servers(); !reflect.DeepEqual(servers, []string{"localhost:8081", "localhost:8082"}) {
+		t.Errorf("Unexpected servers %v", servers)
+	}
+	if !reflect.DeepEqual(config.Servers, c.Servers()) {
+		t.Errorf("Expected config servers %v to match the pool %v", config.Servers, c.Servers())
+	}
+
+	// Bad input keeps the last good config
+	for _, bad := range []string{
+		`{"probe_rate": 2, "q_rif_threshold": 1.5, "servers": ["localhost:8083"]}`,
+		`{"probe_rate": 2, "q_rif_threshold": 0.1, "servers": ["localhost"]}`,
+		`{"probe_rate": 2,`,
+	} {
+		writeFile(t, path, bad)
+		if err := w.Reload(); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+		if config := c.Config(); config.QRIFThreshold != 0.5 {
+			t.Errorf("Expected q_rif_threshold to stay 0.5, got %v", config.QRIFThreshold)
+		}
+		if servers := c.Servers(); len(servers) != 2 {
+			t.Errorf("Expected servers to be unchanged, got %v", servers)
+		}
+	}
+}
+
+func TestFileWatcherTargets(t *testing.T) {
+	c := newTestClient(t, []string{"localhost:8081"})
+	path := filepath.Join(t.TempDir(), "targets.json")
+	w := NewFileWatcher(c, "", path, time.Second)
+
+	writeFile(t, path, `[{"targets": ["localhost:8082"], "labels": {"zone": "a"}},
+		{"targets": ["localhost:8083"]}]`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if servers := c.Servers(); !reflect.DeepEqual(servers, []string{"localhost:8082", "localhost:8083"}) {
+		t.Errorf("Unexpected servers %v", servers)
+	}
+
+	writeFile(t, path, `["localhost:8084"]`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if servers := c.Servers(); !reflect.DeepEqual(servers, []string{"localhost:8084"}) {
+		t.Errorf("Unexpected servers %v", servers)
+	}
+
+	writeFile(t, path, `[]`)
+	if err := w.Reload(); err == nil {
+		t.Errorf("Expected error for empty targets")
+	}
+	if servers := c.Servers(); !reflect.DeepEqual(servers, []string{"localhost:8084"}) {
+		t.Errorf("Expected servers to be unchanged, got %v", servers)
+	}
+}
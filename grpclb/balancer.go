@@ -0,0 +1,222 @@
+package grpclb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-prequel/client"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/grpc/status"
+)
+
+// Name is the name of the Prequal load balancing policy
+const Name = "prequal"
+
+// DefaultServiceConfig selects the Prequal balancer with default tunables.
+// Pass it to grpc.WithDefaultServiceConfig, or embed client.Config fields in
+// the policy's config, e.g. {"loadBalancingConfig": [{"prequal": {"probe_rate": 5}}]}.
+const DefaultServiceConfig = `{"loadBalancingConfig": [{"prequal": {}}]}`
+
+func init() {
+	balancer.Register(&builder{})
+}
+
+// lbConfig is the policy's service config, the client config plus the
+// selection mode
+type lbConfig struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+	client.Config
+	Selection client.SelectionMode `json:"selection"`
+}
+
+type builder struct{}
+
+func (b *builder) Name() string {
+	return Name
+}
+
+// ParseConfig decodes and validates the policy's service config
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &lbConfig{Selection: client.ModeHCL}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("prequal: decode config: %w", err)
+	}
+	if cfg.ProbeRate == 0 {
+		cfg.ProbeRate = 1
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("prequal: %w", err)
+	}
+	if _, err := client.NewSelector(cfg.Selection); err != nil {
+		return nil, fmt.Errorf("prequal: %w", err)
+	}
+	return cfg, nil
+}
+
+// Build creates a balancer that keeps a SubConn per address through the
+// base balancer and picks among the ready ones with a client.Client
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	// Probe connections are dialed like the channel's own connections
+	var dialOpts []grpc.DialOption
+	switch {
+	case opts.DialCreds != nil:
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(opts.DialCreds))
+	case opts.CredsBundle != nil:
+		dialOpts = append(dialOpts, grpc.WithCredentialsBundle(opts.CredsBundle))
+	default:
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if opts.Dialer != nil {
+		dialOpts = append(dialOpts, grpc.WithContextDialer(opts.Dialer))
+	}
+
+	bal := &prequalBalancer{prober: NewProber(dialOpts...)}
+	bal.Balancer = base.NewBalancerBuilder(Name, bal, base.Config{HealthCheck: true}).Build(cc, opts)
+	return bal
+}
+
+type prequalBalancer struct {
+	balancer.Balancer
+
+	prober *Prober
+	client *client.Client
+	mu     sync.Mutex
+}
+
+// UpdateClientConnState applies new addresses and config to the client
+// before letting the base balancer reconcile SubConns
+func (b *prequalBalancer) UpdateClientConnState(state balancer.ClientConnState) error {
+	cfg, ok := state.BalancerConfig.(*lbConfig)
+	if !ok {
+		cfg = &lbConfig{Config: client.Config{ProbeRate: 1}, Selection: client.ModeHCL}
+	}
+
+	servers := make([]string, len(state.ResolverState.Addresses))
+	for i, addr := range state.ResolverState.Addresses {
+		servers[i] = addr.Addr
+	}
+
+	b.mu.Lock()
+	if b.client == nil {
+		b.client = client.NewClient(cfg.Config, servers, cfg.Selection, client.WithProber(b.prober))
+	} else {
+		if err := b.client.UpdateConfig(cfg.Config); err != nil {
+			b.mu.Unlock()
+			return err
+		}
+		if err := b.client.SetServers(servers); err != nil {
+			b.mu.Unlock()
+			// Asks the resolver for a new address list
+			return fmt.Errorf("%w: %v", balancer.ErrBadResolverState, err)
+		}
+	}
+	b.prober.Retain(servers)
+	b.mu.Unlock()
+
+	return b.Balancer.UpdateClientConnState(state)
+}
+
+// ExitIdle forwards to the base balancer
+func (b *prequalBalancer) ExitIdle() {
+	if exitIdler, ok := b.Balancer.(balancer.ExitIdler); ok {
+		exitIdler.ExitIdle()
+	}
+}
+
+// Close stops probing and closes all connections
+func (b *prequalBalancer) Close() {
+	b.Balancer.Close()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.client != nil {
+		b.client.Stop()
+	}
+	b.prober.Close()
+}
+
+// Build creates a picker over the ready SubConns, called by the base balancer
+func (b *prequalBalancer) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &picker{
+		subConns: make(map[string]balancer.SubConn, len(info.ReadySCs)),
+	}
+	for sc, scInfo := range info.ReadySCs {
+		p.subConns[scInfo.Address.Addr] = sc
+		p.servers = append(p.servers, scInfo.Address.Addr)
+	}
+
+	b.mu.Lock()
+	p.client = b.client
+	b.mu.Unlock()
+	return p
+}
+
+type picker struct {
+	client   *client.Client
+	subConns map[string]balancer.SubConn
+	servers  []string
+}
+
+// Pick selects a replica with the client's selector, using the full method
+// name as the job. Until probes cover the ready SubConns it falls back to a
+// random ready one.
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	job := info.FullMethodName
+
+	server, err := p.client.SelectReplica(job)
+	sc, ok := p.subConns[server]
+	if err != nil || !ok {
+		server = p.servers[rand.Intn(len(p.servers))]
+		sc = p.subConns[server]
+	}
+
+	start := time.Now()
+	return balancer.PickResult{
+		SubConn: sc,
+		Done: func(done balancer.DoneInfo) {
+			p.client.ReportOutcome(outcome(server, job, done.Err, time.Since(start)))
+		},
+	}, nil
+}
+
+// outcome translates the result of an RPC into a client outcome. Only codes
+// that point at the replica count as failures, application errors such as
+// NotFound are reported as successes.
+func outcome(server, job string, err error, latency time.Duration) client.Outcome {
+	o := client.Outcome{
+		Server:     server,
+		Job:        job,
+		StatusCode: http.StatusOK,
+		Latency:    latency,
+	}
+
+	switch status.Code(err) {
+	case codes.Canceled:
+		o.StatusCode, o.Err = 0, context.Canceled
+	case codes.DeadlineExceeded:
+		o.StatusCode, o.Err = 0, context.DeadlineExceeded
+	case codes.Unavailable:
+		o.StatusCode, o.Err = 0, err
+	case codes.ResourceExhausted:
+		// The replica sheds load, like an HTTP replica rejecting a request
+		o.StatusCode = http.StatusServiceUnavailable
+		o.Rejected, o.RetryAfter = true, client.DefaultRetryAfter
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		o.StatusCode = http.StatusInternalServerError
+	}
+	return o
+}
@@ -0,0 +1,314 @@
+package grpclb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-prequel/client"
+	"go-prequel/server"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fixedSource reports a constant load
+type fixedSource struct {
+	rif uint64
+}
+
+func (s *fixedSource) Probe() server.ProbeResponse {
+	return server.ProbeResponse{
+		RIF:           s.rif,
+		MedianLatency: time.Millisecond,
+		PathLatencies: map[string]time.Duration{"/test.Who/Who": 2 * time.Millisecond},
+	}
+}
+
+// whoService answers with the name of the replica serving the call
+type whoService interface{}
+
+func whoServiceDesc(name string) *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "test.Who",
+		HandlerType: (*whoService)(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Who",
+				Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+					in := new(emptypb.Empty)
+					if err := dec(in); err != nil {
+						return nil, err
+					}
+					return wrapperspb.String(name), nil
+				},
+			},
+		},
+	}
+}
+
+// startReplicas starts in-process replicas reporting the given RIFs and
+// returns a dialer reaching them by name
+func startReplicas(t *testing.T, rifs []uint64) ([]string, func(context.Context, string) (net.Conn, error)) {
+	t.Helper()
+	listeners := make(map[string]*bufconn.Listener)
+	names := make([]string, len(rifs))
+	for i, rif := range rifs {
+		names[i] = fmt.Sprintf("replica-%d", i)
+		lis := bufconn.Listen(1 << 20)
+		listeners[names[i]] = lis
+
+		s := grpc.NewServer()
+		RegisterProbeServer(s, &fixedSource{rif: rif})
+		s.RegisterService(whoServiceDesc(names[i]), struct{}{})
+		go s.Serve(lis)
+		t.Cleanup(s.Stop)
+	}
+
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		lis, ok := listeners[addr]
+		if !ok {
+			return nil, fmt.Errorf("unknown replica %s", addr)
+		}
+		return lis.DialContext(ctx)
+	}
+	return names, dialer
+}
+
+func TestProber(t *testing.T) {
+	names, dialer := startReplicas(t, []uint64{7})
+	prober := NewProber(grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	defer prober.Close()
+
+	probe, err := prober.Probe(context.Background(), names[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if probe.RIF != 7 || probe.Latency != time.Millisecond || probe.ServerID != names[0] {
+		t.Errorf("Unexpected probe %+v", probe)
+	}
+	if latency := probe.JobLatency("/test.Who/Who"); latency != 2*time.Millisecond {
+		t.Errorf("Expected the method latency to be decoded, got %v", latency)
+	}
+}
+
+func TestBalancerRejectsBadAddresses(t *testing.T) {
+	b := &prequalBalancer{
+		prober: NewProber(),
+		client: client.NewClient(client.Config{ProbeRate: 1}, []string{"a"}, client.ModeHCL),
+	}
+	defer b.client.Stop()
+
+	state := balancer.ClientConnState{ResolverState: resolver.State{Addresses: []resolver.Address{{Addr: ""}}}}
+	if err := b.UpdateClientConnState(state); !errors.Is(err, balancer.ErrBadResolverState) {
+		t.Errorf("Expected ErrBadResolverState, got %v", err)
+	}
+}
+
+func TestBalancerPicksColdReplica(t *testing.T) {
+	names, dialer := startReplicas(t, []uint64{10, 0, 10})
+
+	serviceConfig := `{"loadBalancingConfig": [{"prequal": {
+		"probe_rate": 20, "num_replicas": 1000, "delta_reuse": 9, "q_rif_threshold": 0.75
+	}}]}`
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:///%s,%s,%s", Scheme, names[0], names[1], names[2]),
+		grpc.WithResolvers(NewResolverBuilder(net.DefaultResolver, time.Minute)),
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	who := func() string {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		out := new(wrapperspb.StringValue)
+		if err := conn.Invoke(ctx, "/test.Who/Who", &emptypb.Empty{}, out); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return out.Value
+	}
+
+	// Wait for probes to reach the pool. Until then picks are random, so
+	// require a run of cold picks before measuring.
+	deadline := time.Now().Add(5 * time.Second)
+	for run := 0; run < 5; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Cold replica was never picked consistently")
+		}
+		if who() == names[1] {
+			run++
+		} else {
+			run = 0
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	picked := 0
+	for i := 0; i < 30; i++ {
+		if who() == names[1] {
+			picked++
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if picked < 25 {
+		t.Errorf("Expected the cold replica to be picked most of the time, got %d/30", picked)
+	}
+}
+
+// waitServiceDesc holds every call until release is closed, passing unary
+// calls through the server's interceptor
+func waitServiceDesc(release <-chan struct{}) *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "test.Wait",
+		HandlerType: (*whoService)(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "Wait",
+				Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+					in := new(emptypb.Empty)
+					if err := dec(in); err != nil {
+						return nil, err
+					}
+					handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+						<-release
+						return &emptypb.Empty{}, nil
+					}
+					info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/test.Wait/Wait"}
+					return interceptor(ctx, in, info, handler)
+				},
+			},
+		},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName: "Watch",
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					<-release
+					return nil
+				},
+				ServerStreams: true,
+			},
+		},
+	}
+}
+
+func TestServerInterceptorsTrackCalls(t *testing.T) {
+	tracker := server.NewTracker()
+	release := make(chan struct{})
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(tracker)),
+		grpc.StreamInterceptor(StreamServerInterceptor(tracker)),
+	)
+	RegisterProbeServer(s, tracker)
+	s.RegisterService(waitServiceDesc(release), struct{}{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}
+	conn, err := grpc.NewClient("passthrough:///replica",
+		grpc.WithContextDialer(dialer),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+	prober := NewProber(grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	defer prober.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 2)
+	go func() {
+		done <- conn.Invoke(ctx, "/test.Wait/Wait", &emptypb.Empty{}, &emptypb.Empty{})
+	}()
+	go func() {
+		desc := &grpc.StreamDesc{StreamName: "Watch", ServerStreams: true}
+		stream, err := conn.NewStream(ctx, desc, "/test.Wait/Watch")
+		if err == nil {
+			stream.SendMsg(&emptypb.Empty{})
+			stream.CloseSend()
+			if err = stream.RecvMsg(&emptypb.Empty{}); errors.Is(err, io.EOF) {
+				err = nil
+			}
+		}
+		done <- err
+	}()
+
+	// The probe itself is not counted
+	for tracker.RIF() < 2 {
+		if ctx.Err() != nil {
+			t.Fatalf("Expected both calls to be in flight, got RIF %d", tracker.RIF())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	probe, err := prober.Probe(ctx, "replica")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if probe.RIF != 2 {
+		t.Errorf("Expected the probe to report 2 calls in flight, got %d", probe.RIF)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if rif := tracker.RIF(); rif != 0 {
+		t.Errorf("Expected no calls in flight, got %d", rif)
+	}
+	latencies := tracker.Probe().PathLatencies
+	for _, method := range []string{"/test.Wait/Wait", "/test.Wait/Watch"} {
+		if _, ok := latencies[method]; !ok {
+			t.Errorf("Expected the latency of %s to be tracked, got %v", method, latencies)
+		}
+	}
+}
+
+func TestResourceExhaustedIsRejection(t *testing.T) {
+	err := status.Error(codes.ResourceExhausted, "overloaded")
+	o := outcome("a", "/test.Who/Who", err, time.Millisecond)
+	if !o.Rejected || o.RetryAfter != client.DefaultRetryAfter {
+		t.Errorf("Expected a rejection with the default Retry-After, got %+v", o)
+	}
+
+	// Rejections do not count towards ejection
+	percent := 50
+	c := client.NewClient(client.Config{
+		ProbeRate: 1,
+		Outlier:   client.OutlierConfig{Consecutive5xx: 1, MaxEjectionPercent: &percent},
+	}, []string{"a", "b"}, client.ModeRoundRobin)
+	defer c.Stop()
+	for i := 0; i < 3; i++ {
+		c.ReportOutcome(o)
+	}
+	selected := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		server, err := c.SelectReplica("/test.Who/Who")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		selected[server] = true
+	}
+	if !selected["a"] {
+		t.Errorf("Expected a replica shedding load not to be ejected, got %v", selected)
+	}
+}
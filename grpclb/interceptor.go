@@ -0,0 +1,32 @@
+package grpclb
+
+import (
+	"context"
+	"go-prequel/server"
+
+	"google.golang.org/grpc"
+)
+
+// UnaryServerInterceptor counts the unary calls of a gRPC server as in
+// flight with the tracker and records their latency per full method name,
+// the job the prequal balancer selects for. Calls of the probe service are
+// not counted, like the HTTP probe endpoint.
+func UnaryServerInterceptor(t *server.Tracker) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod == ProbeMethod {
+			return handler(ctx, req)
+		}
+		defer t.Begin(info.FullMethod)()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor counts the streams of a gRPC server as in flight
+// with the tracker until their handler returns, and records their duration
+// per full method name
+func StreamServerInterceptor(t *server.Tracker) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		defer t.Begin(info.FullMethod)()
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,165 @@
+package grpclb
+
+import (
+	"context"
+	"fmt"
+	"go-prequel/client"
+	"go-prequel/server"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+//go:generate protoc --proto_path=.. --go_out=.. --go_opt=paths=source_relative grpclb/probe.proto
+
+// ProbeMethod is the full name of the gRPC probe method. It takes an empty
+// request and answers with a ProbeResponse, which carries the same fields
+// as the JSON served by the HTTP /probe endpoint.
+const ProbeMethod = "/prequal.Probe/Probe"
+
+// ProbeSource reports the load of a server. *server.Server implements it.
+type ProbeSource interface {
+	Probe() server.ProbeResponse
+}
+
+var probeServiceDesc = grpc.ServiceDesc{
+	ServiceName: "prequal.Probe",
+	HandlerType: (*ProbeSource)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Probe",
+			Handler:    probeHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "prequal/probe",
+}
+
+// RegisterProbeServer registers the probe service on a gRPC server, next to
+// the server's own services
+func RegisterProbeServer(s grpc.ServiceRegistrar, source ProbeSource) {
+	s.RegisterService(&probeServiceDesc, source)
+}
+
+func probeHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return newProbeResponse(srv.(ProbeSource).Probe()), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProbeMethod,
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Prober probes replicas through the gRPC probe service. It keeps one
+// connection per replica, separate from the balanced channel.
+type Prober struct {
+	opts  []grpc.DialOption
+	conns map[string]*grpc.ClientConn
+	mu    sync.Mutex
+}
+
+// NewProber creates a prober dialing replicas with the given options
+func NewProber(opts ...grpc.DialOption) *Prober {
+	return &Prober{
+		opts:  opts,
+		conns: make(map[string]*grpc.ClientConn),
+	}
+}
+
+// Probe calls the probe service of the server
+func (p *Prober) Probe(ctx context.Context, server string) (*client.ProbeInfo, error) {
+	conn, err := p.conn(server)
+	if err != nil {
+		return nil, fmt.Errorf("probe failed: %w", err)
+	}
+
+	out := new(ProbeResponse)
+	if err := conn.Invoke(ctx, ProbeMethod, &emptypb.Empty{}, out); err != nil {
+		return nil, fmt.Errorf("probe failed: %w", err)
+	}
+	return out.probeInfo(server), nil
+}
+
+// newProbeResponse converts a server's probe into its proto message
+func newProbeResponse(probe server.ProbeResponse) *ProbeResponse {
+	resp := &ProbeResponse{
+		Rif:      probe.RIF,
+		Latency:  durationpb.New(probe.MedianLatency),
+		Draining: probe.Draining,
+	}
+	if len(probe.PathLatencies) > 0 {
+		resp.PathLatencies = make(map[string]*durationpb.Duration, len(probe.PathLatencies))
+		for path, latency := range probe.PathLatencies {
+			resp.PathLatencies[path] = durationpb.New(latency)
+		}
+	}
+	return resp
+}
+
+// probeInfo converts the probe of a server into what the client keeps
+func (x *ProbeResponse) probeInfo(server string) *client.ProbeInfo {
+	info := &client.ProbeInfo{
+		RIF:       x.GetRif(),
+		Latency:   x.GetLatency().AsDuration(),
+		ServerID:  server,
+		Timestamp: time.Now(),
+		Draining:  x.GetDraining(),
+	}
+	if len(x.GetPathLatencies()) > 0 {
+		info.JobLatencies = make(map[string]time.Duration, len(x.GetPathLatencies()))
+		for path, latency := range x.GetPathLatencies() {
+			info.JobLatencies[path] = latency.AsDuration()
+		}
+	}
+	return info
+}
+
+func (p *Prober) conn(server string) (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if conn, ok := p.conns[server]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient("passthrough:///"+server, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[server] = conn
+	return conn, nil
+}
+
+// Retain closes the connections of servers that are not in the list
+func (p *Prober) Retain(servers []string) {
+	keep := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		keep[server] = true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for server, conn := range p.conns {
+		if !keep[server] {
+			conn.Close()
+			delete(p.conns, server)
+		}
+	}
+}
+
+// Close closes all probe connections
+func (p *Prober) Close() {
+	p.Retain(nil)
+}
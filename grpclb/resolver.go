@@ -0,0 +1,117 @@
+package grpclb
+
+import (
+	"context"
+	"go-prequel/discovery"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the resolver scheme for Prequal targets. The endpoint is a comma
+// separated list of discovery targets, e.g.
+// prequal:///localhost:8081,dns:///svc.local:8082
+const Scheme = "prequal"
+
+func init() {
+	resolver.Register(NewResolverBuilder(net.DefaultResolver, 30*time.Second))
+}
+
+// NewResolverBuilder creates a resolver builder that expands targets with
+// the given DNS resolver and re-resolves them on every interval
+func NewResolverBuilder(dns discovery.Resolver, interval time.Duration) resolver.Builder {
+	return &resolverBuilder{dns: dns, interval: interval}
+}
+
+type resolverBuilder struct {
+	dns      discovery.Resolver
+	interval time.Duration
+}
+
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &prequalResolver{
+		cc:       cc,
+		dns:      b.dns,
+		targets:  strings.Split(target.Endpoint(), ","),
+		interval: b.interval,
+		now:      make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		logger:   log.New(os.Stdout, "[Resolver] ", log.LstdFlags),
+	}
+	r.wg.Add(1)
+	go r.watch()
+	return r, nil
+}
+
+type prequalResolver struct {
+	cc       resolver.ClientConn
+	dns      discovery.Resolver
+	targets  []string
+	interval time.Duration
+
+	now    chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+	logger *log.Logger
+}
+
+// watch resolves the targets right away, then on every interval and
+// whenever gRPC asks for it
+func (r *prequalResolver) watch() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.resolve()
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		case <-r.now:
+		}
+	}
+}
+
+func (r *prequalResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+	defer cancel()
+
+	servers, err := discovery.Resolve(ctx, r.dns, r.targets)
+	if err != nil {
+		r.logger.Printf("Failed to resolve %v: %v", r.targets, err)
+		r.cc.ReportError(err)
+		return
+	}
+
+	addrs := make([]resolver.Address, len(servers))
+	for i, server := range servers {
+		addrs[i] = resolver.Address{Addr: server}
+	}
+	if err := r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		r.logger.Printf("Failed to update state: %v", err)
+	}
+}
+
+// ResolveNow triggers an immediate re-resolution
+func (r *prequalResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops re-resolving
+func (r *prequalResolver) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
@@ -1,46 +1,123 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"go-prequel/client"
+	"go-prequel/discovery"
 	"go-prequel/metrics"
 	"go-prequel/server"
 	"log"
 	"math/rand"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
 func main() {
-	mode := flag.String("mode", "", "Mode to run: server or client")
-	port := flag.String("port", "8080", "Port to run the server on (server mode only)")
-	configPath := flag.String("config", "", "Path to the config file (client mode only)")
-	selMode := flag.String("selection", "hcl", "Server selection mode (hcl/round_robin)")
+	mode := flag.String("mode", "", "Mode to run: server, client or proxy")
+	port := flag.String("port", "8080", "Port to run the server or proxy on (server and proxy modes only)")
+	configPath := flag.String("config", "", "Path to the config file (client and proxy modes only)")
+	selMode := flag.String("selection", "hcl", fmt.Sprintf("Server selection mode (%s)", strings.Join(client.SelectionModes(), "/")))
 	metricsPort := flag.String("metrics-port", "8099", "Port to run the metrics server on")
+	targetsPath := flag.String("targets", "", "Path to a file_sd style targets file overriding the config servers (client and proxy modes only)")
+	resolveInterval := flag.Duration("resolve-interval", 30*time.Second, "How often to re-resolve dns:/// and srv:/// servers (client and proxy modes only)")
+	watchInterval := flag.Duration("watch-interval", 0, "How often to reload the config and targets files, 0 disables watching (client and proxy modes only)")
+	estimator := flag.String("estimator", server.EstimatorNearest, fmt.Sprintf("Latency estimator (%s) (server mode only)", strings.Join(server.Estimators(), "/")))
+	maxSampleAge := flag.Duration("max-sample-age", 0, "Ignore latency samples older than this, 0 keeps them (server mode only)")
+	sampleHalfLife := flag.Duration("sample-half-life", 0, "Halve the weight of latency samples every half-life, 0 weighs them equally (server mode only)")
+	lameDuck := flag.Duration("lame-duck", 2*time.Second, "How long to advertise draining on shutdown before closing (server mode only)")
+	maxRIF := flag.Uint64("max-rif", 0, "Reject requests with 503 above this many requests in flight, 0 disables the limit (server mode only)")
+	priorities := flag.String("priorities", "", "Comma separated path=priority pairs, priority being critical, default or sheddable (server mode only)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests on shutdown (server mode only)")
 
 	flag.Parse()
 
+	opts := clientOptions{
+		configPath:      *configPath,
+		targetsPath:     *targetsPath,
+		selMode:         *selMode,
+		watchInterval:   *watchInterval,
+		resolveInterval: *resolveInterval,
+	}
+
 	switch *mode {
 	case "server":
-		runServer(*port)
+		runServer(*port, server.Config{
+			Estimator:   *estimator,
+			SampleDecay: server.SampleDecay{MaxAge: *maxSampleAge, HalfLife: *sampleHalfLife},
+			LameDuck:    *lameDuck,
+			Admission: server.AdmissionConfig{
+				MaxRIF:     *maxRIF,
+				Priorities: parsePriorities(*priorities),
+			},
+		}, *shutdownTimeout)
 	case "client":
-		runClient(*configPath, *selMode, *metricsPort)
+		runClient(opts, *metricsPort)
+	case "proxy":
+		runProxy(opts, *port, *metricsPort)
 	default:
-		log.Fatalf("Invalid mode: %s. Use 'server' or 'client'.", *mode)
+		log.Fatalf("Invalid mode: %s. Use 'server', 'client' or 'proxy'.", *mode)
 	}
 }
 
-func runServer(port string) {
-	s := server.NewServer()
-	addr := fmt.Sprintf("localhost:%s", port)
-	err := s.Start(addr)
+// clientOptions holds the flags shared by the client and proxy modes
+type clientOptions struct {
+	configPath      string
+	targetsPath     string
+	selMode         string
+	watchInterval   time.Duration
+	resolveInterval time.Duration
+}
+
+func runServer(port string, config server.Config, shutdownTimeout time.Duration) {
+	s, err := server.NewServerWithConfig(config)
 	if err != nil {
+		log.Fatalf("Invalid server config: %v", err)
+	}
+
+	// Channel to listen for OS signals
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	drained := make(chan struct{})
+	go func() {
+		<-sigs
+		log.Println("Received shutdown signal, draining server...")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Printf("Server did not drain: %v", err)
+		}
+		close(drained)
+	}()
+
+	addr := fmt.Sprintf("localhost:%s", port)
+	if err := s.Start(addr); err != http.ErrServerClosed {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+	<-drained
+}
+
+// parsePriorities parses the -priorities flag
+func parsePriorities(value string) map[string]server.Priority {
+	if value == "" {
+		return nil
+	}
+	priorities := make(map[string]server.Priority)
+	for _, pair := range strings.Split(value, ",") {
+		path, priority, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			log.Fatalf("Invalid priority %q, expected path=priority", pair)
+		}
+		priorities[path] = server.Priority(priority)
+	}
+	return priorities
 }
 
 func collectMetrics(metricsPort string) {
@@ -48,8 +125,14 @@ func collectMetrics(metricsPort string) {
 	metrics.StartMetricsServer("localhost:" + metricsPort)
 }
 
-func runClient(configPath string, selMode string, metricsPort string) {
-	file, err := os.Open(configPath)
+// startClient creates a client from the config and starts service discovery.
+// The returned function stops discovery and the client.
+func startClient(opts clientOptions) (*client.Client, func()) {
+	if _, err := client.NewSelector(client.SelectionMode(opts.selMode)); err != nil {
+		log.Fatalf("Invalid selection mode: %v", err)
+	}
+
+	file, err := os.Open(opts.configPath)
 	if err != nil {
 		log.Fatalf("Failed to open config file: %v", err)
 	}
@@ -59,8 +142,67 @@ func runClient(configPath string, selMode string, metricsPort string) {
 	if err := json.NewDecoder(file).Decode(&config); err != nil {
 		log.Fatalf("Failed to decode config file: %v", err)
 	}
+	if err := config.Validate(); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
 
-	c := client.NewClient(config, config.Servers, client.SelectionMode(selMode))
+	servers := config.Servers
+	if opts.targetsPath != "" {
+		data, err := os.ReadFile(opts.targetsPath)
+		if err != nil {
+			log.Fatalf("Failed to read targets file: %v", err)
+		}
+		if servers, err = discovery.ParseTargets(data); err != nil {
+			log.Fatalf("Failed to parse targets file: %v", err)
+		}
+	}
+
+	// DNS targets are resolved up front and then re-resolved periodically
+	var dnsTargets []string
+	for _, server := range servers {
+		if discovery.IsDNSTarget(server) {
+			dnsTargets = servers
+			break
+		}
+	}
+	if dnsTargets != nil {
+		if opts.watchInterval > 0 {
+			log.Fatalf("File watching only supports host:port servers, DNS servers are re-resolved every -resolve-interval")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), opts.resolveInterval)
+		servers, err = discovery.Resolve(ctx, net.DefaultResolver, dnsTargets)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to resolve servers: %v", err)
+		}
+	}
+	if err := discovery.ValidateTargets(servers); err != nil {
+		log.Fatalf("Invalid servers: %v", err)
+	}
+
+	c := client.NewClient(config, servers, client.SelectionMode(opts.selMode))
+
+	stops := []func(){c.Stop}
+	if dnsTargets != nil {
+		dnsWatcher := discovery.NewDNSWatcher(c, net.DefaultResolver, dnsTargets, opts.resolveInterval)
+		dnsWatcher.Start()
+		stops = append(stops, dnsWatcher.Stop)
+	}
+	if opts.watchInterval > 0 {
+		watcher := discovery.NewFileWatcher(c, opts.configPath, opts.targetsPath, opts.watchInterval)
+		watcher.Start()
+		stops = append(stops, watcher.Stop)
+	}
+
+	return c, func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+}
+
+func runClient(opts clientOptions, metricsPort string) {
+	c, stop := startClient(opts)
 
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
@@ -93,8 +235,36 @@ func runClient(configPath string, selMode string, metricsPort string) {
 			}
 		case <-sigs:
 			log.Println("Received shutdown signal, stopping client...")
-			c.Stop()
+			stop()
 			return
 		}
 	}
 }
+
+func runProxy(opts clientOptions, port string, metricsPort string) {
+	c, stop := startClient(opts)
+	collectMetrics(metricsPort)
+
+	addr := fmt.Sprintf("localhost:%s", port)
+	srv := &http.Server{Addr: addr, Handler: client.NewProxy(c)}
+
+	// Channel to listen for OS signals
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	drained := make(chan struct{})
+	go func() {
+		<-sigs
+		log.Println("Received shutdown signal, stopping proxy...")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+		close(drained)
+	}()
+
+	log.Printf("Starting proxy on %s", addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("Failed to start proxy: %v", err)
+	}
+	<-drained
+	stop()
+}
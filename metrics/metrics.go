@@ -32,6 +32,51 @@ var (
 		Name: "probe_stale_total",
 		Help: "Total number of probes considered stale due to age",
 	})
+	membershipChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_pool_changes_total",
+		Help: "Total number of servers added to or removed from the server pool",
+	}, []string{"change"}) // change will be "added" or "removed"
+	serverPoolSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "server_pool_size",
+		Help: "Current number of servers in the client's server pool",
+	})
+	requestOutcomes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_request_outcomes_total",
+		Help: "Total number of requests sent to each server by outcome",
+	}, []string{"server_id", "result"})
+	clientRequestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "client_request_latency_seconds",
+		Help:    "Client observed request latency in seconds by path",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // from 1ms to ~16s
+	}, []string{"path"})
+	probeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "probe_failures_total",
+		Help: "Total number of failed probes per server",
+	}, []string{"server_id", "reason"}) // reason will be "timeout" or "error"
+	healthTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_health_transitions_total",
+		Help: "Total number of server health state changes",
+	}, []string{"server_id", "state"}) // state will be "healthy" or "unhealthy"
+	unhealthyServers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "unhealthy_servers",
+		Help: "Number of servers currently excluded from selection as unhealthy",
+	})
+	outlierEjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "outlier_ejections_total",
+		Help: "Total number of servers ejected by outlier detection",
+	}, []string{"server_id", "reason"}) // reason will be "consecutive_5xx" or "success_rate"
+	ejectedServers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ejected_servers",
+		Help: "Number of servers currently ejected by outlier detection",
+	})
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_retries_total",
+		Help: "Total number of failed requests considered for a retry per path",
+	}, []string{"path", "result"}) // result will be "retried", "budget_exhausted" or "no_replica"
+	hedges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "client_hedges_total",
+		Help: "Total number of hedge requests sent per path",
+	}, []string{"path", "result"}) // result will be "won" or "lost"
 	ProbeSelectionCount = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "probe_selection_total",
@@ -61,6 +106,12 @@ var (
 		Name: "server_median_latency_seconds",
 		Help: "Current median latency across all requests",
 	})
+
+	// Requests shed by admission control by path
+	rejectedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "server_rejected_requests_total",
+		Help: "Total number of requests rejected by admission control per path",
+	}, []string{"path", "reason"}) // reason will be "overloaded" or "deadline"
 )
 
 func InitClientMetrics() {
@@ -70,12 +121,24 @@ func InitClientMetrics() {
 	prometheus.MustRegister(probeReuseCount)
 	prometheus.MustRegister(staleProbes)
 	prometheus.MustRegister(ProbeSelectionCount)
+	prometheus.MustRegister(membershipChanges)
+	prometheus.MustRegister(serverPoolSize)
+	prometheus.MustRegister(requestOutcomes)
+	prometheus.MustRegister(clientRequestLatency)
+	prometheus.MustRegister(probeFailures)
+	prometheus.MustRegister(healthTransitions)
+	prometheus.MustRegister(unhealthyServers)
+	prometheus.MustRegister(outlierEjections)
+	prometheus.MustRegister(ejectedServers)
+	prometheus.MustRegister(retries)
+	prometheus.MustRegister(hedges)
 }
 
 func InitServerMetrics() {
 	prometheus.MustRegister(CurrentRIF)
 	prometheus.MustRegister(RequestLatency)
 	prometheus.MustRegister(MedianLatency)
+	prometheus.MustRegister(rejectedRequests)
 }
 
 // IncrementServerChosen increments the counter for the chosen server
@@ -107,6 +170,85 @@ func AddStaleProbes(count int) {
 	staleProbes.Add(float64(count))
 }
 
+// AddMembershipChanges increments the server pool change counter
+func AddMembershipChanges(change string, count int) {
+	if count > 0 {
+		membershipChanges.With(prometheus.Labels{"change": change}).Add(float64(count))
+	}
+}
+
+// UpdateServerPoolSize updates the server pool size gauge
+func UpdateServerPoolSize(size int) {
+	serverPoolSize.Set(float64(size))
+}
+
+// IncrementProbeFailure increments the failed probe counter for a server
+func IncrementProbeFailure(serverID, reason string) {
+	probeFailures.With(prometheus.Labels{
+		"server_id": serverID,
+		"reason":    reason,
+	}).Inc()
+}
+
+// IncrementHealthTransition counts a server changing health state
+func IncrementHealthTransition(serverID, state string) {
+	healthTransitions.With(prometheus.Labels{
+		"server_id": serverID,
+		"state":     state,
+	}).Inc()
+}
+
+// UpdateUnhealthyServers updates the number of unhealthy servers
+func UpdateUnhealthyServers(n int) {
+	unhealthyServers.Set(float64(n))
+}
+
+// IncrementOutlierEjection counts a server being ejected
+func IncrementOutlierEjection(serverID, reason string) {
+	outlierEjections.With(prometheus.Labels{
+		"server_id": serverID,
+		"reason":    reason,
+	}).Inc()
+}
+
+// UpdateEjectedServers updates the number of ejected servers
+func UpdateEjectedServers(n int) {
+	ejectedServers.Set(float64(n))
+}
+
+// IncrementRetry counts a failed request that was retried or could not be
+// retried for lack of retry budget or of a replica to retry on
+func IncrementRetry(path, result string) {
+	retries.With(prometheus.Labels{
+		"path":   path,
+		"result": result,
+	}).Inc()
+}
+
+// IncrementHedge counts a hedge request that answered first or lost to
+// the original request
+func IncrementHedge(path, result string) {
+	hedges.With(prometheus.Labels{
+		"path":   path,
+		"result": result,
+	}).Inc()
+}
+
+// IncrementRequestOutcome increments the request outcome counter for a server
+func IncrementRequestOutcome(serverID, result string) {
+	requestOutcomes.With(prometheus.Labels{
+		"server_id": serverID,
+		"result":    result,
+	}).Inc()
+}
+
+// ObserveClientRequestLatency records the client observed latency of a request
+func ObserveClientRequestLatency(path string, duration time.Duration) {
+	clientRequestLatency.With(prometheus.Labels{
+		"path": path,
+	}).Observe(duration.Seconds())
+}
+
 // Server metric update functions
 func UpdateCurrentRIF(value int64) {
 	CurrentRIF.Set(float64(value))
@@ -122,6 +264,14 @@ func UpdateMedianLatency(value time.Duration) {
 	MedianLatency.Set(value.Seconds())
 }
 
+// IncrementRejectedRequest counts a request rejected by admission control
+func IncrementRejectedRequest(path, reason string) {
+	rejectedRequests.With(prometheus.Labels{
+		"path":   path,
+		"reason": reason,
+	}).Inc()
+}
+
 // StartMetricsServer starts an HTTP server for exposing Prometheus metrics
 func StartMetricsServer(addr string) {
 	http.Handle("/metrics", promhttp.Handler())
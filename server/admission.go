@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"go-prequel/metrics"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DeadlineHeader carries the time the client is willing to wait for a
+	// response, in milliseconds
+	DeadlineHeader = "X-Prequal-Deadline"
+	// RejectedHeader is set on responses rejected by admission control, with
+	// the reason of the rejection
+	RejectedHeader = "X-Prequal-Rejected"
+)
+
+// Priority decides how early requests to a path are shed
+type Priority string
+
+const (
+	// PriorityCritical requests are never shed for exceeding the RIF limit
+	PriorityCritical Priority = "critical"
+	// PriorityDefault requests are shed above the RIF limit
+	PriorityDefault Priority = "default"
+	// PrioritySheddable requests are shed above half of the RIF limit, so
+	// they make room for more important requests first
+	PrioritySheddable Priority = "sheddable"
+)
+
+// AdmissionConfig configures load shedding. Requests are rejected with 503
+// Service Unavailable and a Retry-After header when the RIF exceeds the
+// limit of their path's priority, or when the latency estimated at the
+// current RIF exceeds the deadline sent by the client, as the response
+// would arrive too late anyway.
+type AdmissionConfig struct {
+	MaxRIF     uint64              `json:"max_rif"`     // RIF above which requests are shed, 0 disables the limit
+	RetryAfter time.Duration       `json:"retry_after"` // Advertised in Retry-After when rejecting (default 1s)
+	Priorities map[string]Priority `json:"priorities"`  // Priority per path, paths not listed have PriorityDefault
+}
+
+// Validate checks the admission configuration
+func (a AdmissionConfig) Validate() error {
+	if a.RetryAfter < 0 {
+		return fmt.Errorf("retry after must not be negative")
+	}
+	for path, priority := range a.Priorities {
+		switch priority {
+		case PriorityCritical, PriorityDefault, PrioritySheddable:
+		default:
+			return fmt.Errorf("unknown priority %q for path %s", priority, path)
+		}
+	}
+	return nil
+}
+
+func (a *AdmissionConfig) setDefaults() {
+	if a.RetryAfter == 0 {
+		a.RetryAfter = time.Second
+	}
+}
+
+// rifLimit returns the RIF above which requests of the given priority are
+// shed, 0 if they are never shed
+func (a AdmissionConfig) rifLimit(priority Priority) uint64 {
+	switch {
+	case a.MaxRIF == 0 || priority == PriorityCritical:
+		return 0
+	case priority == PrioritySheddable:
+		return max(a.MaxRIF/2, 1)
+	default:
+		return a.MaxRIF
+	}
+}
+
+// admit decides whether a request to path that arrived at the given RIF is
+// served, returning the reason if it is not
+func (t *Tracker) admit(r *http.Request, path string, rif uint64) (string, bool) {
+	priority := t.admission.Priorities[path]
+	if limit := t.admission.rifLimit(priority); limit > 0 && rif > limit {
+		return "overloaded", false
+	}
+
+	if deadline, ok := requestDeadline(r); ok {
+		if latency := t.admissionEstimate(path, rif); latency > deadline {
+			return "deadline", false
+		}
+	}
+	return "", true
+}
+
+// reject answers a request shed by admission control
+func (t *Tracker) reject(w http.ResponseWriter, path, reason string) {
+	metrics.IncrementRejectedRequest(t.metricPath(path), reason)
+
+	seconds := int(math.Ceil(t.admission.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	w.Header().Set(RejectedHeader, reason)
+	http.Error(w, "Service unavailable: "+reason, http.StatusServiceUnavailable)
+}
+
+// requestDeadline returns the deadline sent by the client, if any
+func requestDeadline(r *http.Request) (time.Duration, bool) {
+	value := r.Header.Get(DeadlineHeader)
+	if value == "" {
+		return 0, false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
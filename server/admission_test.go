@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveAt sends a request to path through the tracker's middleware while rif
+// other requests are in flight
+func serveAt(tracker *Tracker, path string, rif uint64, header http.Header) *httptest.ResponseRecorder {
+	for i := uint64(0); i < rif; i++ {
+		tracker.incrementRIF()
+	}
+	defer func() {
+		for i := uint64(0); i < rif; i++ {
+			tracker.decrementRIF()
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdmissionRIFLimit(t *testing.T) {
+	tracker, err := NewTrackerWithConfig(Config{Admission: AdmissionConfig{
+		MaxRIF: 10,
+		Priorities: map[string]Priority{
+			"/health": PriorityCritical,
+			"/batch":  PrioritySheddable,
+		},
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		rif      uint64
+		expected int
+	}{
+		{"/ping", 9, http.StatusOK},
+		{"/ping", 10, http.StatusServiceUnavailable},
+		{"/batch", 4, http.StatusOK},
+		{"/batch", 5, http.StatusServiceUnavailable},
+		{"/health", 100, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := serveAt(tracker, tt.path, tt.rif, nil)
+		if rec.Code != tt.expected {
+			t.Errorf("%s at RIF %d: expected status %d, got %d", tt.path, tt.rif, tt.expected, rec.Code)
+		}
+	}
+
+	rec := serveAt(tracker, "/ping", 10, nil)
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", retryAfter)
+	}
+	if reason := rec.Header().Get(RejectedHeader); reason != "overloaded" {
+		t.Errorf("Expected rejection reason overloaded, got %q", reason)
+	}
+	if rif := tracker.RIF(); rif != 0 {
+		t.Errorf("Expected rejected requests to leave RIF at 0, got %d", rif)
+	}
+}
+
+func TestAdmissionDeadline(t *testing.T) {
+	tracker := NewTracker()
+	tracker.recordLatency("/medium", 1, 3*time.Second)
+
+	rec := serveAt(tracker, "/medium", 0, http.Header{DeadlineHeader: {"500"}})
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get(RejectedHeader) != "deadline" {
+		t.Errorf("Expected a deadline rejection, got %d %q", rec.Code, rec.Header().Get(RejectedHeader))
+	}
+
+	rec = serveAt(tracker, "/medium", 0, http.Header{DeadlineHeader: {"5000"}})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 within the deadline, got %d", rec.Code)
+	}
+}
+
+func TestAdmissionUsesBandEstimator(t *testing.T) {
+	tracker, err := NewTrackerWithConfig(Config{Estimator: EstimatorNearest})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tracker.recordLatency("/medium", 1, time.Second)
+
+	// Deadline checks must not scan the samples of the nearest estimator
+	for path, estimators := range map[string]*pathEstimators{"": &tracker.estimators, "/medium": tracker.pathEstimators["/medium"]} {
+		if _, ok := estimators.admission.(*bandEstimator); !ok {
+			t.Errorf("Expected a band estimator for admission of %q, got %T", path, estimators.admission)
+		}
+	}
+	if latency := tracker.admissionEstimate("/medium", 1); latency != time.Second {
+		t.Errorf("Expected an admission estimate of 1s, got %v", latency)
+	}
+}
+
+func BenchmarkAdmitDeadline(b *testing.B) {
+	tracker := NewTracker()
+	for i := 0; i < 1000; i++ {
+		tracker.recordLatency("/medium", uint64(i%64), time.Millisecond)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/medium", nil)
+	req.Header.Set(DeadlineHeader, "500")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tracker.admit(req, "/medium", uint64(i%64))
+	}
+}
+
+func TestAdmissionConfigValidate(t *testing.T) {
+	config := Config{Admission: AdmissionConfig{Priorities: map[string]Priority{"/ping": "urgent"}}}
+	if _, err := NewTrackerWithConfig(config); err == nil {
+		t.Errorf("Expected error for unknown priority")
+	}
+}
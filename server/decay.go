@@ -0,0 +1,72 @@
+package server
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// SampleDecay configures how estimators age latency samples, so probes
+// report current conditions rather than those of a busy period long past
+type SampleDecay struct {
+	MaxAge   time.Duration `json:"max_sample_age"`   // Samples older than this are ignored, 0 keeps them
+	HalfLife time.Duration `json:"sample_half_life"` // The weight of a sample halves every HalfLife, 0 weighs samples equally
+}
+
+// enabled reports whether samples age at all
+func (d SampleDecay) enabled() bool {
+	return d.MaxAge > 0 || d.HalfLife > 0
+}
+
+// expired reports whether a sample taken at t is too old to use at now
+func (d SampleDecay) expired(t, now time.Time) bool {
+	return d.MaxAge > 0 && now.Sub(t) > d.MaxAge
+}
+
+// weight returns the weight at now of a sample taken at t
+func (d SampleDecay) weight(t, now time.Time) float64 {
+	if d.HalfLife <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(now.Sub(t)) / float64(d.HalfLife))
+}
+
+// sample is a latency observed at a point in time
+type sample struct {
+	latency time.Duration
+	at      time.Time
+}
+
+// median returns the weighted median latency of the samples that have not
+// expired at now, or false if there are none. samples is reordered.
+func (d SampleDecay) median(samples []sample, now time.Time) (time.Duration, bool) {
+	live := samples[:0]
+	for _, s := range samples {
+		if !d.expired(s.at, now) {
+			live = append(live, s)
+		}
+	}
+	if len(live) == 0 {
+		return 0, false
+	}
+	slices.SortFunc(live, func(a, b sample) int {
+		return cmp.Compare(a.latency, b.latency)
+	})
+	if d.HalfLife <= 0 {
+		return live[len(live)/2].latency, true
+	}
+
+	var total float64
+	for _, s := range live {
+		total += d.weight(s.at, now)
+	}
+	var cumulative float64
+	for _, s := range live {
+		cumulative += d.weight(s.at, now)
+		if cumulative >= total/2 {
+			return s.latency, true
+		}
+	}
+	return live[len(live)-1].latency, true
+}
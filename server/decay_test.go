@@ -0,0 +1,74 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for estimators
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// setClock makes a registered estimator read the time from clock
+func setClock(t *testing.T, e Estimator, clock *fakeClock) {
+	t.Helper()
+	switch e := e.(type) {
+	case *MetricReporter:
+		e.now = clock.now
+	case *bandEstimator:
+		e.now = clock.now
+	default:
+		t.Fatalf("Unknown estimator %T", e)
+	}
+}
+
+func TestSampleMaxAge(t *testing.T) {
+	for _, name := range Estimators() {
+		t.Run(name, func(t *testing.T) {
+			e, _ := NewEstimator(name, SampleDecay{MaxAge: time.Minute})
+			clock := &fakeClock{t: time.Now()}
+			setClock(t, e, clock)
+
+			for i := 0; i < 10; i++ {
+				e.Record(4, time.Second)
+			}
+			clock.t = clock.t.Add(2 * time.Minute)
+			if latency := e.Estimate(4); latency != 0 {
+				t.Errorf("Expected expired samples to be ignored, got %v", latency)
+			}
+
+			for i := 0; i < 10; i++ {
+				e.Record(4, time.Millisecond)
+			}
+			if latency := e.Estimate(4); latency != time.Millisecond {
+				t.Errorf("Expected only fresh samples to count, got %v", latency)
+			}
+		})
+	}
+}
+
+func TestSampleHalfLife(t *testing.T) {
+	decay := SampleDecay{HalfLife: time.Second}
+	now := time.Now()
+
+	// Two old slow samples are outweighed by one fresh fast sample
+	samples := []sample{
+		{latency: time.Second, at: now.Add(-10 * time.Second)},
+		{latency: time.Second, at: now.Add(-10 * time.Second)},
+		{latency: time.Millisecond, at: now},
+	}
+	if latency, _ := decay.median(samples, now); latency != time.Millisecond {
+		t.Errorf("Expected the fresh sample to dominate, got %v", latency)
+	}
+
+	e, _ := NewEstimator(EstimatorEWMA, decay)
+	clock := &fakeClock{t: now}
+	setClock(t, e, clock)
+	e.Record(1, time.Second)
+	clock.t = clock.t.Add(10 * time.Second)
+	e.Record(1, time.Millisecond)
+	if latency := e.Estimate(1); latency > 2*time.Millisecond {
+		t.Errorf("Expected the EWMA to follow a sample after a quiet period, got %v", latency)
+	}
+}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Estimator estimates the latency of a request arriving at a given RIF from
+// the latencies of past requests. Implementations must be safe for
+// concurrent use.
+type Estimator interface {
+	Record(rif uint64, latency time.Duration)
+	Estimate(rif uint64) time.Duration
+}
+
+// EstimatorFactory creates a new, empty Estimator aging its samples as
+// configured by decay
+type EstimatorFactory func(decay SampleDecay) Estimator
+
+const (
+	// EstimatorNearest is the median of the samples nearest in RIF
+	EstimatorNearest = "nearest"
+	// EstimatorBucket is the median of a sliding window per RIF band
+	EstimatorBucket = "bucket"
+	// EstimatorEWMA is an exponentially weighted moving average per RIF band
+	EstimatorEWMA = "ewma"
+	// EstimatorQuantile is a streaming median sketch per RIF band
+	EstimatorQuantile = "quantile"
+)
+
+var (
+	estimatorsMu sync.RWMutex
+	estimators   = map[string]EstimatorFactory{}
+)
+
+// RegisterEstimator makes an estimator available under the given name.
+// Registering the same name twice replaces the earlier factory.
+func RegisterEstimator(name string, factory EstimatorFactory) {
+	estimatorsMu.Lock()
+	defer estimatorsMu.Unlock()
+	estimators[name] = factory
+}
+
+// NewEstimator creates an Estimator registered under name
+func NewEstimator(name string, decay SampleDecay) (Estimator, error) {
+	estimatorsMu.RLock()
+	defer estimatorsMu.RUnlock()
+
+	factory, ok := estimators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown estimator: %s", name)
+	}
+	return factory(decay), nil
+}
+
+// Estimators returns the names of all registered estimators
+func Estimators() []string {
+	estimatorsMu.RLock()
+	defer estimatorsMu.RUnlock()
+
+	names := make([]string, 0, len(estimators))
+	for name := range estimators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterEstimator(EstimatorNearest, func(decay SampleDecay) Estimator {
+		return NewMetricReporterWithDecay(decay)
+	})
+	RegisterEstimator(EstimatorBucket, func(decay SampleDecay) Estimator {
+		return newBandEstimator(func() bandStat { return &windowStat{decay: decay} })
+	})
+	RegisterEstimator(EstimatorEWMA, func(decay SampleDecay) Estimator {
+		return newBandEstimator(func() bandStat { return &ewmaStat{decay: decay} })
+	})
+	RegisterEstimator(EstimatorQuantile, func(decay SampleDecay) Estimator {
+		return newBandEstimator(func() bandStat { return &sketchStat{decay: decay} })
+	})
+}
+
+// Record implements Estimator
+func (m *MetricReporter) Record(rif uint64, latency time.Duration) {
+	m.recordMetric(rif, latency)
+}
+
+// Estimate implements Estimator
+func (m *MetricReporter) Estimate(rif uint64) time.Duration {
+	return m.getNearestLatencies(rif)
+}
+
+// numBands is the number of RIF bands, one per bit length of a uint64
+const numBands = 65
+
+// rifBand maps a RIF to its band: 0, 1, 2-3, 4-7, 8-15 and so on. Latency
+// grows roughly with RIF, so bands get wider as the RIF grows.
+func rifBand(rif uint64) int {
+	return bits.Len64(rif)
+}
+
+// bandStat summarizes the latencies recorded in one RIF band
+type bandStat interface {
+	add(latency time.Duration, at time.Time)
+	// estimate returns false if the band holds no sample young enough
+	estimate(now time.Time) (time.Duration, bool)
+}
+
+// bandEstimator keeps a summary of latencies per RIF band and answers
+// from the band of the RIF, or the nearest band with live samples. Both
+// recording and estimating cost O(1) in the number of samples.
+type bandEstimator struct {
+	bands   [numBands]bandStat
+	newStat func() bandStat
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+func newBandEstimator(newStat func() bandStat) *bandEstimator {
+	return &bandEstimator{newStat: newStat, now: time.Now}
+}
+
+// Record implements Estimator
+func (e *bandEstimator) Record(rif uint64, latency time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	band := rifBand(rif)
+	if e.bands[band] == nil {
+		e.bands[band] = e.newStat()
+	}
+	e.bands[band].add(latency, e.now())
+}
+
+// Estimate implements Estimator
+func (e *bandEstimator) Estimate(rif uint64) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	band := rifBand(rif)
+	for d := 0; d < numBands; d++ {
+		for _, b := range []int{band - d, band + d} {
+			if b < 0 || b >= numBands || e.bands[b] == nil {
+				continue
+			}
+			if latency, ok := e.bands[b].estimate(now); ok {
+				return latency
+			}
+		}
+	}
+	return 0
+}
+
+// windowSize is the number of recent samples kept per band by windowStat
+const windowSize = 64
+
+// windowStat is the median of the most recent samples in a band
+type windowStat struct {
+	samples []sample
+	next    int
+	decay   SampleDecay
+}
+
+func (w *windowStat) add(latency time.Duration, at time.Time) {
+	if len(w.samples) < windowSize {
+		w.samples = append(w.samples, sample{latency: latency, at: at})
+		return
+	}
+	w.samples[w.next] = sample{latency: latency, at: at}
+	w.next = (w.next + 1) % windowSize
+}
+
+func (w *windowStat) estimate(now time.Time) (time.Duration, bool) {
+	var buf [windowSize]sample
+	samples := buf[:len(w.samples)]
+	copy(samples, w.samples)
+	return w.decay.median(samples, now)
+}
+
+// ewmaAlpha is the weight of a new sample in ewmaStat
+const ewmaAlpha = 0.1
+
+// ewmaStat is an exponentially weighted moving average of a band. With a
+// half-life, a sample following a quiet period of one half-life gets at
+// least half of the weight.
+type ewmaStat struct {
+	value  float64
+	last   time.Time
+	primed bool
+	decay  SampleDecay
+}
+
+func (e *ewmaStat) add(latency time.Duration, at time.Time) {
+	if !e.primed || e.decay.expired(e.last, at) {
+		e.value, e.last, e.primed = float64(latency), at, true
+		return
+	}
+	alpha := max(ewmaAlpha, 1-e.decay.weight(e.last, at))
+	e.value += alpha * (float64(latency) - e.value)
+	e.last = at
+}
+
+func (e *ewmaStat) estimate(now time.Time) (time.Duration, bool) {
+	if e.decay.expired(e.last, now) {
+		return 0, false
+	}
+	return time.Duration(e.value), true
+}
+
+// sketchWindow is the number of samples after which sketchStat starts a
+// new sketch, so the estimate follows changes in load
+const sketchWindow = 1000
+
+// sketchStat estimates the median of a band with the P² algorithm, in
+// constant memory. The previous sketch answers until the current one has
+// enough samples. A sketch is also restarted once it covers more than the
+// maximum sample age, or one half-life.
+type sketchStat struct {
+	current, previous *p2Quantile
+	started, last     time.Time
+	decay             SampleDecay
+}
+
+func (s *sketchStat) add(latency time.Duration, at time.Time) {
+	if s.current == nil || s.current.count >= sketchWindow || s.stale(at) {
+		s.previous, s.current, s.started = s.current, newP2Quantile(0.5), at
+		if s.decay.expired(s.last, at) {
+			s.previous = nil
+		}
+	}
+	s.current.add(float64(latency))
+	s.last = at
+}
+
+// stale reports whether the current sketch started too long before at
+func (s *sketchStat) stale(at time.Time) bool {
+	age := at.Sub(s.started)
+	return (s.decay.MaxAge > 0 && age > s.decay.MaxAge) || (s.decay.HalfLife > 0 && age > s.decay.HalfLife)
+}
+
+func (s *sketchStat) estimate(now time.Time) (time.Duration, bool) {
+	if s.decay.expired(s.last, now) {
+		return 0, false
+	}
+	if s.current.count < p2Markers && s.previous != nil {
+		return time.Duration(s.previous.estimate()), true
+	}
+	return time.Duration(s.current.estimate()), true
+}
+
+// p2Markers is the number of markers tracked by the P² algorithm
+const p2Markers = 5
+
+// p2Quantile estimates a quantile of a stream with the P² algorithm by
+// Jain and Chlamtac, which tracks five markers instead of the samples.
+type p2Quantile struct {
+	p       float64
+	count   int
+	heights [p2Markers]float64
+	pos     [p2Markers]float64 // Actual marker positions
+	desired [p2Markers]float64 // Desired marker positions
+	incr    [p2Markers]float64 // Desired position increments per sample
+}
+
+func newP2Quantile(p float64) *p2Quantile {
+	return &p2Quantile{
+		p:       p,
+		pos:     [p2Markers]float64{1, 2, 3, 4, 5},
+		desired: [p2Markers]float64{1, 1 + 2*p, 1 + 4*p, 3 + 2*p, 5},
+		incr:    [p2Markers]float64{0, p / 2, p, (1 + p) / 2, 1},
+	}
+}
+
+func (q *p2Quantile) add(x float64) {
+	if q.count < p2Markers {
+		q.heights[q.count] = x
+		q.count++
+		if q.count == p2Markers {
+			slices.Sort(q.heights[:])
+		}
+		return
+	}
+	q.count++
+
+	// Find the cell of x, extending the extremes if needed
+	var k int
+	switch {
+	case x < q.heights[0]:
+		q.heights[0] = x
+		k = 0
+	case x >= q.heights[4]:
+		q.heights[4] = x
+		k = 3
+	default:
+		for k = 0; x >= q.heights[k+1]; k++ {
+		}
+	}
+	for i := k + 1; i < p2Markers; i++ {
+		q.pos[i]++
+	}
+	for i := range q.desired {
+		q.desired[i] += q.incr[i]
+	}
+
+	// Move the middle markers towards their desired positions
+	for i := 1; i < p2Markers-1; i++ {
+		d := q.desired[i] - q.pos[i]
+		if (d >= 1 && q.pos[i+1]-q.pos[i] > 1) || (d <= -1 && q.pos[i-1]-q.pos[i] < -1) {
+			sign := 1.0
+			if d < 0 {
+				sign = -1
+			}
+			h := q.parabolic(i, sign)
+			if h <= q.heights[i-1] || h >= q.heights[i+1] {
+				h = q.linear(i, sign)
+			}
+			q.heights[i] = h
+			q.pos[i] += sign
+		}
+	}
+}
+
+func (q *p2Quantile) parabolic(i int, d float64) float64 {
+	return q.heights[i] + d/(q.pos[i+1]-q.pos[i-1])*
+		((q.pos[i]-q.pos[i-1]+d)*(q.heights[i+1]-q.heights[i])/(q.pos[i+1]-q.pos[i])+
+			(q.pos[i+1]-q.pos[i]-d)*(q.heights[i]-q.heights[i-1])/(q.pos[i]-q.pos[i-1]))
+}
+
+func (q *p2Quantile) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return q.heights[i] + d*(q.heights[j]-q.heights[i])/(q.pos[j]-q.pos[i])
+}
+
+func (q *p2Quantile) estimate() float64 {
+	if q.count >= p2Markers {
+		return q.heights[2]
+	}
+	sorted := slices.Clone(q.heights[:q.count])
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// syntheticLatency models a replica whose latency grows linearly with RIF,
+// with noise of up to ±50%
+func syntheticLatency(r *rand.Rand, rif uint64) time.Duration {
+	base := time.Duration(rif+1) * time.Millisecond
+	return base/2 + time.Duration(r.Int63n(int64(base)))
+}
+
+func TestEstimators(t *testing.T) {
+	for _, name := range Estimators() {
+		t.Run(name, func(t *testing.T) {
+			e, err := NewEstimator(name, SampleDecay{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if latency := e.Estimate(4); latency != 0 {
+				t.Errorf("Expected 0 without samples, got %v", latency)
+			}
+
+			for i := 0; i < 100; i++ {
+				e.Record(2, 10*time.Millisecond)
+				e.Record(50, time.Second)
+			}
+			if latency := e.Estimate(2); latency != 10*time.Millisecond {
+				t.Errorf("Expected 10ms at low RIF, got %v", latency)
+			}
+			if latency := e.Estimate(40); latency != time.Second {
+				t.Errorf("Expected 1s at high RIF, got %v", latency)
+			}
+		})
+	}
+
+	if _, err := NewEstimator("unknown", SampleDecay{}); err == nil {
+		t.Errorf("Expected error for unknown estimator")
+	}
+}
+
+func TestP2Quantile(t *testing.T) {
+	q := newP2Quantile(0.5)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		q.add(r.Float64() * 100)
+	}
+	if median := q.estimate(); math.Abs(median-50) > 2 {
+		t.Errorf("Expected median close to 50, got %v", median)
+	}
+}
+
+// BenchmarkEstimate measures the cost of answering a probe once the
+// estimator holds 1000 samples
+func BenchmarkEstimate(b *testing.B) {
+	for _, name := range Estimators() {
+		b.Run(name, func(b *testing.B) {
+			e, _ := NewEstimator(name, SampleDecay{})
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 1000; i++ {
+				rif := uint64(r.Intn(64))
+				e.Record(rif, syntheticLatency(r, rif))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				e.Estimate(uint64(i % 64))
+			}
+		})
+	}
+}
+
+// BenchmarkRecord measures the cost added to every request
+func BenchmarkRecord(b *testing.B) {
+	for _, name := range Estimators() {
+		b.Run(name, func(b *testing.B) {
+			e, _ := NewEstimator(name, SampleDecay{})
+			for i := 0; i < b.N; i++ {
+				e.Record(uint64(i%64), time.Millisecond)
+			}
+		})
+	}
+}
+
+// BenchmarkEstimateAccuracy reports the mean relative error of the
+// estimates against the true median latency at each RIF
+func BenchmarkEstimateAccuracy(b *testing.B) {
+	for _, name := range Estimators() {
+		b.Run(name, func(b *testing.B) {
+			var totalErr float64
+			var estimates int
+			for i := 0; i < b.N; i++ {
+				e, _ := NewEstimator(name, SampleDecay{})
+				r := rand.New(rand.NewSource(int64(i)))
+				for j := 0; j < 1000; j++ {
+					rif := uint64(r.Intn(64))
+					e.Record(rif, syntheticLatency(r, rif))
+				}
+				for rif := uint64(0); rif < 64; rif++ {
+					truth := float64(rif+1) * float64(time.Millisecond)
+					totalErr += math.Abs(float64(e.Estimate(rif))-truth) / truth
+					estimates++
+				}
+			}
+			b.ReportMetric(totalErr/float64(estimates), "rel_err")
+		})
+	}
+}
+
+func ExampleNewEstimator() {
+	e, _ := NewEstimator(EstimatorBucket, SampleDecay{})
+	e.Record(3, 20*time.Millisecond)
+	fmt.Println(e.Estimate(2))
+	// Output: 20ms
+}
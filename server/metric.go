@@ -2,77 +2,101 @@ package server
 
 import (
 	"time"
-	"sync"
-	"container/heap"
-	"sort"
 )
 
+// maxMetrics is how many of the latest samples a MetricReporter keeps
+const maxMetrics = 1000
+
 type Metric struct {
-	RIF     uint64
-	Latency time.Duration
+	RIF       uint64
+	Latency   time.Duration
+	Timestamp time.Time // Zero unless the samples age
 }
 
+// MetricReporter keeps the last maxMetrics samples in a lock-free ring, so
+// recording a sample never serializes request handlers
 type MetricReporter struct {
-	metrics    []Metric
-	maxMetrics int
-	metricsMu  sync.RWMutex
+	metrics *sampleRing
+
+	decay SampleDecay
+	now   func() time.Time
 }
 
 func NewMetricReporter() *MetricReporter {
+	return NewMetricReporterWithDecay(SampleDecay{})
+}
+
+// NewMetricReporterWithDecay creates a reporter that ages its samples
+func NewMetricReporterWithDecay(decay SampleDecay) *MetricReporter {
 	return &MetricReporter{
-		metrics:    make([]Metric, 0, 1000),
-		maxMetrics: 1000,
+		metrics: newSampleRing(maxMetrics),
+		decay:   decay,
+		now:     time.Now,
 	}
 }
 
 func (m *MetricReporter) recordMetric(rif uint64, latency time.Duration) {
-	m.metricsMu.Lock()
-	defer m.metricsMu.Unlock()
-
 	metric := Metric{RIF: rif, Latency: latency}
+	// Samples are only timestamped when they age
+	if m.decay.enabled() {
+		metric.Timestamp = m.now()
+	}
+	m.metrics.add(metric)
+}
+
+// numNearest is how many samples nearest in RIF the median is taken over
+const numNearest = 5
 
-	m.metrics = append(m.metrics, metric)
+// nearestSamples keeps the samples nearest to a RIF seen so far
+type nearestSamples struct {
+	dists   [numNearest]uint64
+	samples [numNearest]sample
+	n       int
+}
 
-	// Maintain max size
-	if len(m.metrics) > m.maxMetrics {
-		m.metrics = m.metrics[1:]
+// add offers a sample at the given RIF distance, replacing the farthest
+// kept sample once numNearest are kept
+func (s *nearestSamples) add(dist uint64, sample sample) {
+	if s.n < numNearest {
+		s.dists[s.n], s.samples[s.n] = dist, sample
+		s.n++
+		return
+	}
+	farthest := 0
+	for i := 1; i < numNearest; i++ {
+		if s.dists[i] > s.dists[farthest] {
+			farthest = i
+		}
+	}
+	if dist < s.dists[farthest] {
+		s.dists[farthest], s.samples[farthest] = dist, sample
 	}
 }
 
 func (m *MetricReporter) getNearestLatencies(rif uint64) time.Duration {
-	m.metricsMu.RLock()
-	defer m.metricsMu.RUnlock()
-
-	if len(m.metrics) == 0 {
+	if m.metrics.len() == 0 {
 		return 0
 	}
 
-	h := &MaxHeap{}
-	heap.Init(h)
-
-	for _, metric := range m.metrics {
+	var now time.Time
+	aging := m.decay.enabled()
+	if aging {
+		now = m.now()
+	}
+	var nearest nearestSamples
+	m.metrics.each(func(metric Metric) {
+		if aging && m.decay.expired(metric.Timestamp, now) {
+			return
+		}
 		absDiff := uint64(0)
 		if metric.RIF > rif {
 			absDiff = metric.RIF - rif
 		} else {
 			absDiff = rif - metric.RIF
 		}
-		customMetric := Metric{RIF: absDiff, Latency: metric.Latency}
-
-		heap.Push(h, customMetric)
-		if h.Len() > 5 {
-			heap.Pop(h)
-		}
-	}
-
-	latencies := make([]time.Duration, h.Len())
-	for i := range latencies {
-		latencies[i] = heap.Pop(h).(Metric).Latency
-	}
-
-	sort.Slice(latencies, func(i, j int) bool {
-		return latencies[i] < latencies[j]
+		nearest.add(absDiff, sample{latency: metric.Latency, at: metric.Timestamp})
 	})
 
-	return latencies[len(latencies)/2]
+	latency, _ := m.decay.median(nearest.samples[:nearest.n], now)
+	return latency
 }
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// DefaultProbePath is the path the probe endpoint is served on by default
+const DefaultProbePath = "/probe"
+
+// ProbeHandler serves the probe endpoint of a Tracker. It has no dependency
+// on the demo Server, so services owning their own http.Server can mount it
+// next to their handlers.
+type ProbeHandler struct {
+	tracker *Tracker
+	path    string
+	logger  *log.Logger // Optional, probes are not logged if nil
+}
+
+// ProbeOption configures a ProbeHandler
+type ProbeOption func(*ProbeHandler)
+
+// WithProbePath serves the probe endpoint on path instead of DefaultProbePath
+func WithProbePath(path string) ProbeOption {
+	return func(h *ProbeHandler) {
+		h.path = path
+	}
+}
+
+// WithProbeLogger logs every probe answered to logger
+func WithProbeLogger(logger *log.Logger) ProbeOption {
+	return func(h *ProbeHandler) {
+		h.logger = logger
+	}
+}
+
+// NewProbeHandler creates a probe handler reporting the state of tracker
+func NewProbeHandler(tracker *Tracker, opts ...ProbeOption) *ProbeHandler {
+	h := &ProbeHandler{tracker: tracker, path: DefaultProbePath}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Path returns the path the probe endpoint is served on
+func (h *ProbeHandler) Path() string {
+	return h.path
+}
+
+// Register mounts the probe endpoint on mux
+func (h *ProbeHandler) Register(mux *http.ServeMux) {
+	mux.Handle(h.path, h)
+}
+
+// Handler serves the probe endpoint and passes all other requests to next.
+// Probes bypass next, so wrapping a tracked handler does not count them as
+// requests in flight.
+func (h *ProbeHandler) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == h.path {
+			h.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP answers a probe with the JSON encoded ProbeResponse
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	probe := h.tracker.Probe()
+	if h.logger != nil {
+		h.logger.Printf("Current RIF: %d, Median Latency: %v", probe.RIF, probe.MedianLatency)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(probe); err != nil && h.logger != nil {
+		h.logger.Printf("Failed to encode probe response: %v", err)
+	}
+}
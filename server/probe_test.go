@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbeHandlerPath(t *testing.T) {
+	tracker := NewTracker()
+	tracker.recordLatency("/ping", 0, time.Millisecond)
+	h := NewProbeHandler(tracker, WithProbePath("/internal/prequal"))
+
+	mux := http.NewServeMux()
+	h.Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/prequal", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", ct)
+	}
+	var probe ProbeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&probe); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if probe.MedianLatency != time.Millisecond {
+		t.Errorf("Expected latency %v, got %v", time.Millisecond, probe.MedianLatency)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DefaultProbePath, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 on the default path, got %d", rec.Code)
+	}
+}
+
+func TestProbeHandlerRejectsMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewProbeHandler(NewTracker()).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/probe", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+}
+
+func TestProbeHandlerWrapsHandler(t *testing.T) {
+	tracker := NewTracker()
+	var rifs []uint64
+	app := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rifs = append(rifs, tracker.RIF())
+	}))
+	handler := NewProbeHandler(tracker).Handler(app)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/probe", nil))
+
+	if len(rifs) != 1 {
+		t.Errorf("Expected only /orders to reach the handler, got %d requests", len(rifs))
+	}
+	if _, ok := tracker.Probe().PathLatencies["/probe"]; ok {
+		t.Errorf("Expected probes not to be tracked")
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// sampleRing is a fixed-size, lock-free ring buffer of RIF/latency samples.
+// Writers claim slots with an atomic counter and publish them with a
+// per-slot sequence number, so readers never see torn samples and neither
+// side ever blocks the other.
+type sampleRing struct {
+	slots []ringSlot
+	head  atomic.Uint64
+}
+
+// ringSlot holds one sample. seq is 0 before the first write and odd while
+// a writer fills the slot.
+type ringSlot struct {
+	seq     atomic.Uint64
+	rif     atomic.Uint64
+	latency atomic.Int64
+	at      atomic.Int64 // Unix nanoseconds
+}
+
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{slots: make([]ringSlot, size)}
+}
+
+// add stores a sample, overwriting the oldest one once the ring is full. If
+// a slow writer still holds the claimed slot the sample is dropped, which
+// only happens when the ring wraps around during a single write.
+func (r *sampleRing) add(metric Metric) {
+	i := r.head.Add(1) - 1
+	slot := &r.slots[i%uint64(len(r.slots))]
+
+	seq := slot.seq.Load()
+	if seq%2 == 1 || !slot.seq.CompareAndSwap(seq, seq+1) {
+		return
+	}
+	slot.rif.Store(metric.RIF)
+	slot.latency.Store(int64(metric.Latency))
+	var at int64
+	if !metric.Timestamp.IsZero() {
+		at = metric.Timestamp.UnixNano()
+	}
+	slot.at.Store(at)
+	slot.seq.Store(seq + 2)
+}
+
+// len returns the number of samples written so far, up to the ring size
+func (r *sampleRing) len() int {
+	return int(min(r.head.Load(), uint64(len(r.slots))))
+}
+
+// each calls fn for every sample in the ring. Samples written concurrently
+// may or may not be seen.
+func (r *sampleRing) each(fn func(Metric)) {
+	for i := range r.slots {
+		slot := &r.slots[i]
+		seq := slot.seq.Load()
+		if seq == 0 || seq%2 == 1 {
+			continue
+		}
+		metric := Metric{
+			RIF:     slot.rif.Load(),
+			Latency: time.Duration(slot.latency.Load()),
+		}
+		if at := slot.at.Load(); at != 0 {
+			metric.Timestamp = time.Unix(0, at)
+		}
+		// Skip the slot if a writer overwrote it while it was read
+		if slot.seq.Load() != seq {
+			continue
+		}
+		fn(metric)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSampleRingKeepsLatestSamples(t *testing.T) {
+	r := newSampleRing(4)
+	for i := 1; i <= 10; i++ {
+		r.add(Metric{RIF: uint64(i), Latency: time.Duration(i), Timestamp: time.Now()})
+	}
+
+	if r.len() != 4 {
+		t.Errorf("Expected 4 samples, got %d", r.len())
+	}
+	seen := make(map[uint64]bool)
+	r.each(func(m Metric) {
+		if m.Latency != time.Duration(m.RIF) {
+			t.Errorf("Torn sample %+v", m)
+		}
+		seen[m.RIF] = true
+	})
+	for i := uint64(7); i <= 10; i++ {
+		if !seen[i] {
+			t.Errorf("Expected sample %d to be kept, got %v", i, seen)
+		}
+	}
+}
+
+func TestSampleRingConcurrentAccess(t *testing.T) {
+	r := newSampleRing(64)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				// Every sample has matching fields, so a torn read shows
+				r.add(Metric{RIF: uint64(i), Latency: time.Duration(i), Timestamp: time.Unix(0, int64(i))})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			r.each(func(m Metric) {
+				if m.Latency != time.Duration(m.RIF) || m.Timestamp.UnixNano() != int64(m.RIF) {
+					t.Errorf("Torn sample %+v", m)
+				}
+			})
+		}
+	}()
+	wg.Wait()
+	<-done
+}
+
+// lockedSamples is the previous mutex guarded slice, kept as a baseline
+type lockedSamples struct {
+	metrics []Metric
+	mu      sync.RWMutex
+}
+
+func (l *lockedSamples) add(metric Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.metrics = append(l.metrics, metric)
+	if len(l.metrics) > 1000 {
+		l.metrics = l.metrics[1:]
+	}
+}
+
+func (l *lockedSamples) each(fn func(Metric)) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, metric := range l.metrics {
+		fn(metric)
+	}
+}
+
+// sampleStore is implemented by both sample buffers
+type sampleStore interface {
+	add(Metric)
+	each(func(Metric))
+}
+
+// BenchmarkRecordParallel measures recording from many handlers at once
+// while probes read the samples
+func BenchmarkRecordParallel(b *testing.B) {
+	stores := []struct {
+		name  string
+		store sampleStore
+	}{
+		{"ring", newSampleRing(1000)},
+		{"mutex", &lockedSamples{}},
+	}
+
+	for _, s := range stores {
+		b.Run(s.name, func(b *testing.B) {
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				for {
+					select {
+					case <-done:
+						return
+					case <-time.After(time.Millisecond):
+						s.store.each(func(Metric) {})
+					}
+				}
+			}()
+
+			now := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				var i uint64
+				for pb.Next() {
+					i++
+					s.store.add(Metric{RIF: i, Latency: time.Millisecond, Timestamp: now})
+				}
+			})
+		})
+	}
+}
@@ -1,13 +1,14 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"go-prequel/metrics"
 	"log"
 	"net/http"
 	"os"
-	"sync/atomic"
+	"sync"
 	"time"
 
 	"math/rand"
@@ -16,12 +17,23 @@ import (
 )
 
 type Server struct {
-	rif uint64 // Request in flight counter
+	tracker  *Tracker // Tracks RIF and latency of the handled requests
+	probe    *ProbeHandler
+	lameDuck time.Duration
+	port     string
+	logger   *log.Logger
+
+	httpServer *http.Server
+	closed     bool // Set by Shutdown, a later Start returns right away
+	mu         sync.Mutex
+}
 
-	// Store last 1000 RIF-latency pairs
-	metricReporter *MetricReporter
-	port           string
-	logger         *log.Logger
+// Config holds server configuration
+type Config struct {
+	Estimator string `json:"estimator"` // Latency estimator, one of Estimators() (default "nearest")
+	SampleDecay
+	LameDuck  time.Duration   `json:"lame_duck"` // Minimum time Shutdown advertises draining before closing
+	Admission AdmissionConfig `json:"admission"` // Load shedding, disabled by default
 }
 
 type BatchRequest struct {
@@ -33,27 +45,38 @@ type Response struct {
 }
 
 type ProbeResponse struct {
-	RIF           uint64        `json:"rif"`
-	MedianLatency time.Duration `json:"latency"`
+	RIF           uint64                   `json:"rif"`
+	MedianLatency time.Duration            `json:"latency"`
+	PathLatencies map[string]time.Duration `json:"path_latencies,omitempty"` // Latency estimated for each path at the current RIF
+	Draining      bool                     `json:"draining,omitempty"`       // Set while the server shuts down, clients should stop selecting it
 }
 
 func NewServer() *Server {
-	return &Server{
-		metricReporter: NewMetricReporter(),
-	}
-}
-
-func (s *Server) incrementRIF() uint64 {
-	return atomic.AddUint64(&s.rif, 1)
+	s, _ := NewServerWithConfig(Config{})
+	return s
 }
 
-func (s *Server) decrementRIF() uint64 {
-	return atomic.AddUint64(&s.rif, ^uint64(0))
+// NewServerWithConfig creates a server with the given configuration
+func NewServerWithConfig(config Config) (*Server, error) {
+	if config.LameDuck < 0 {
+		return nil, fmt.Errorf("lame duck period must not be negative")
+	}
+	tracker, err := NewTrackerWithConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	logger := log.New(os.Stdout, "[Server] ", log.LstdFlags)
+	return &Server{
+		tracker:  tracker,
+		probe:    NewProbeHandler(tracker, WithProbeLogger(logger)),
+		lameDuck: config.LameDuck,
+		logger:   logger,
+	}, nil
 }
 
-// getCurrentRIF returns the current RIF value
-func (s *Server) getCurrentRIF() uint64 {
-	return atomic.LoadUint64(&s.rif)
+// Tracker returns the tracker of the server's requests
+func (s *Server) Tracker() *Tracker {
+	return s.tracker
 }
 
 func (s *Server) HandleBatchProcess(w http.ResponseWriter, r *http.Request) {
@@ -62,16 +85,6 @@ func (s *Server) HandleBatchProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rif := s.incrementRIF()
-	metrics.UpdateCurrentRIF(int64(rif))
-	start := time.Now()
-	defer func() {
-		s.decrementRIF()
-		duration := time.Since(start)
-		s.metricReporter.recordMetric(rif, duration)
-		metrics.ObserveRequestLatency("/batch", duration)
-	}()
-
 	var req BatchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -94,16 +107,6 @@ func (s *Server) HandlePing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rif := s.incrementRIF()
-	metrics.UpdateCurrentRIF(int64(rif))
-	start := time.Now()
-	defer func() {
-		s.decrementRIF()
-		duration := time.Since(start)
-		s.metricReporter.recordMetric(rif, duration)
-		metrics.ObserveRequestLatency("/ping", duration)
-	}()
-
 	json.NewEncoder(w).Encode(Response{Message: "pong"})
 }
 
@@ -113,16 +116,6 @@ func (s *Server) HandleMediumProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rif := s.incrementRIF()
-	metrics.UpdateCurrentRIF(int64(rif))
-	start := time.Now()
-	defer func() {
-		s.decrementRIF()
-		duration := time.Since(start)
-		s.metricReporter.recordMetric(rif, duration)
-		metrics.ObserveRequestLatency("/medium", duration)
-	}()
-
 	// Simulate medium processing
 	baseDuration := 3 * time.Second
 	randomOffset := time.Duration(rand.Intn(3)-1) * time.Second // Random duration between -10 and +10 seconds
@@ -133,37 +126,76 @@ func (s *Server) HandleMediumProcess(w http.ResponseWriter, r *http.Request) {
 
 // HandleProbe handles probe requests
 func (s *Server) HandleProbe(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	currentRIF := s.getCurrentRIF()
-	medianLatency := s.metricReporter.getNearestLatencies(currentRIF)
-	s.logger.Printf("Current RIF: %d, Median Latency: %v", currentRIF, medianLatency)
-	metrics.UpdateMedianLatency(medianLatency)
+	s.probe.ServeHTTP(w, r)
+}
 
-	json.NewEncoder(w).Encode(ProbeResponse{
-		RIF:           currentRIF,
-		MedianLatency: medianLatency,
-	})
+// Probe returns the server's current RIF and the latency estimated for it
+func (s *Server) Probe() ProbeResponse {
+	return s.tracker.Probe()
 }
 
 func (s *Server) Start(addr string) error {
-	// Initialize logger with address prefix
-	prefix := fmt.Sprintf("[Server %s] ", addr)
-	s.logger = log.New(os.Stdout, prefix, log.LstdFlags)
+	// Prefix the logger with the address
+	s.logger.SetPrefix(fmt.Sprintf("[Server %s] ", addr))
+
+	mux := http.NewServeMux()
+	mux.Handle("/batch", s.tracker.Middleware(http.HandlerFunc(s.HandleBatchProcess)))
+	mux.Handle("/ping", s.tracker.Middleware(http.HandlerFunc(s.HandlePing)))
+	mux.Handle("/medium", s.tracker.Middleware(http.HandlerFunc(s.HandleMediumProcess)))
+	s.probe.Register(mux)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.httpServer = srv
+	s.mu.Unlock()
 
 	metrics.InitServerMetrics()
 
 	s.logger.Printf("Starting server on %s", addr)
+	return srv.ListenAndServe()
+}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/batch", s.HandleBatchProcess)
-	mux.HandleFunc("/ping", s.HandlePing)
-	mux.HandleFunc("/medium", s.HandleMediumProcess)
-	mux.HandleFunc("/probe", s.HandleProbe)
-	mux.Handle("/metrics", promhttp.Handler())
+// Shutdown gracefully stops the server. It enters lame-duck mode, in which
+// probes report the server as draining while it keeps serving, for at least
+// the configured lame duck period so clients can pick the state up. Once no
+// request is left in flight the server is closed. If ctx is done first the
+// server is closed immediately and the context's error returned. Start
+// returns http.ErrServerClosed after Shutdown, even if Shutdown was called
+// before Start.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.tracker.Drain()
+	s.logger.Printf("Draining with %d requests in flight", s.tracker.RIF())
+
+	s.mu.Lock()
+	s.closed = true
+	srv := s.httpServer
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
 
-	return http.ListenAndServe(addr, mux)
+	err := s.drain(ctx)
+	if err != nil {
+		srv.Close()
+		return err
+	}
+	s.logger.Printf("Drained, shutting down")
+	return srv.Shutdown(ctx)
+}
+
+// drain waits out the lame duck period and then for the in-flight requests
+func (s *Server) drain(ctx context.Context) error {
+	timer := time.NewTimer(s.lameDuck)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	return s.tracker.WaitIdle(ctx)
 }
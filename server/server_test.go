@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbeReportsPathLatencies(t *testing.T) {
+	s := NewServer()
+	s.tracker.recordLatency("/ping", 1, time.Millisecond)
+	s.tracker.recordLatency("/batch", 1, 10*time.Second)
+
+	probe := s.Probe()
+	if latency := probe.PathLatencies["/ping"]; latency != time.Millisecond {
+		t.Errorf("Expected /ping latency %v, got %v", time.Millisecond, latency)
+	}
+	if latency := probe.PathLatencies["/batch"]; latency != 10*time.Second {
+		t.Errorf("Expected /batch latency %v, got %v", 10*time.Second, latency)
+	}
+}
+
+func TestHandleProbeBeforeStart(t *testing.T) {
+	s := NewServer()
+	rec := httptest.NewRecorder()
+	s.HandleProbe(rec, httptest.NewRequest(http.MethodGet, "/probe", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
+
+// serve runs s on a local port without Start, which registers the metrics
+// and can only be called once per process
+func serve(t *testing.T, s *Server) <-chan error {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.httpServer = &http.Server{Handler: http.NewServeMux()}
+	served := make(chan error, 1)
+	go func() { served <- s.httpServer.Serve(l) }()
+	return served
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	s, err := NewServerWithConfig(Config{LameDuck: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	served := serve(t, s)
+
+	s.tracker.incrementRIF()
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+
+	time.Sleep(50 * time.Millisecond)
+	if !s.Probe().Draining {
+		t.Errorf("Expected probes to report draining")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Expected Shutdown to wait for the request in flight, got %v", err)
+	default:
+	}
+
+	s.tracker.decrementRIF()
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := NewServer()
+	serve(t, s)
+
+	s.tracker.incrementRIF()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestShutdownBeforeStart(t *testing.T) {
+	s := NewServer()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := s.Start("localhost:0"); err != http.ErrServerClosed {
+		t.Errorf("Expected Start after Shutdown to return %v, got %v", http.ErrServerClosed, err)
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"go-prequel/metrics"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxTrackedPaths bounds the number of paths with their own latency
+// estimator. Requests to further paths only feed the server-wide one.
+const maxTrackedPaths = 64
+
+// OtherPath is the metric label of requests to paths that are not tracked,
+// which keeps the label cardinality bounded by maxTrackedPaths
+const OtherPath = "other"
+
+// Tracker tracks the requests in flight (RIF) of a replica and the latency
+// of its requests, which is what a Prequal probe reports. Wrapping a
+// handler with Middleware and serving the probe endpoint makes any HTTP
+// service a Prequal replica.
+type Tracker struct {
+	rif      uint64      // Request in flight counter
+	draining atomic.Bool // Set once the replica is shutting down
+
+	// Latency estimators, server-wide and per path
+	estimators     pathEstimators
+	pathEstimators map[string]*pathEstimators
+	newEstimators  func() *pathEstimators
+	pathMu         sync.RWMutex
+
+	admission AdmissionConfig
+
+	// Path maps a request to the path its latency is tracked under.
+	// Defaults to the URL path; services with unbounded paths, e.g. ones
+	// containing IDs, should map them to their route.
+	Path func(r *http.Request) string
+}
+
+// NewTracker creates a tracker using the default estimator
+func NewTracker() *Tracker {
+	t, _ := NewTrackerWithConfig(Config{})
+	return t
+}
+
+// NewTrackerWithConfig creates a tracker with the estimator and sample
+// decay of the given configuration
+func NewTrackerWithConfig(config Config) (*Tracker, error) {
+	if config.Estimator == "" {
+		config.Estimator = EstimatorNearest
+	}
+	if config.MaxAge < 0 || config.HalfLife < 0 {
+		return nil, fmt.Errorf("sample max age and half-life must not be negative")
+	}
+	if err := config.Admission.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid admission config: %w", err)
+	}
+	config.Admission.setDefaults()
+	if _, err := NewEstimator(config.Estimator, config.SampleDecay); err != nil {
+		return nil, err
+	}
+
+	newEstimators := func() *pathEstimators {
+		probe, _ := NewEstimator(config.Estimator, config.SampleDecay)
+		admission, _ := NewEstimator(EstimatorBucket, config.SampleDecay)
+		return &pathEstimators{probe: probe, admission: admission}
+	}
+	return &Tracker{
+		estimators:     *newEstimators(),
+		pathEstimators: make(map[string]*pathEstimators),
+		newEstimators:  newEstimators,
+		admission:      config.Admission,
+	}, nil
+}
+
+// pathEstimators holds the latency estimators of a path
+type pathEstimators struct {
+	probe Estimator // Of the configured kind, reported in probes
+	// Queried by deadline checks on every request, so it is always a band
+	// estimator whose estimates cost O(1) whatever probes use
+	admission Estimator
+}
+
+func (e *pathEstimators) record(rif uint64, latency time.Duration) {
+	e.probe.Record(rif, latency)
+	e.admission.Record(rif, latency)
+}
+
+// DefaultTracker is the tracker used by Middleware
+var DefaultTracker = NewTracker()
+
+// Middleware tracks the requests handled by next with DefaultTracker
+func Middleware(next http.Handler) http.Handler {
+	return DefaultTracker.Middleware(next)
+}
+
+// Middleware counts the requests handled by next as in flight and records
+// their latency against the RIF they arrived at. Requests shed by admission
+// control are neither counted nor recorded.
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := t.path(r)
+		rif := t.incrementRIF()
+		if reason, ok := t.admit(r, path, rif); !ok {
+			t.decrementRIF()
+			t.reject(w, path, reason)
+			return
+		}
+		defer t.begin(path, rif)()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Begin counts a request to path as in flight and returns the func that
+// ends it, which records its latency against the RIF it arrived at. It
+// feeds the tracker from servers that are not HTTP handlers, e.g. gRPC
+// services; path should have few distinct values, such as a method name.
+func (t *Tracker) Begin(path string) (end func()) {
+	return t.begin(path, t.incrementRIF())
+}
+
+// begin starts tracking a request that already incremented the RIF to rif
+func (t *Tracker) begin(path string, rif uint64) func() {
+	metrics.UpdateCurrentRIF(int64(rif))
+	start := time.Now()
+	return func() {
+		t.decrementRIF()
+		t.recordLatency(path, rif, time.Since(start))
+	}
+}
+
+func (t *Tracker) path(r *http.Request) string {
+	if t.Path != nil {
+		return t.Path(r)
+	}
+	return r.URL.Path
+}
+
+// recordLatency records the latency of a request to path that arrived at
+// the given RIF
+func (t *Tracker) recordLatency(path string, rif uint64, latency time.Duration) {
+	t.estimators.record(rif, latency)
+
+	t.pathMu.RLock()
+	estimators, ok := t.pathEstimators[path]
+	t.pathMu.RUnlock()
+	if !ok {
+		t.pathMu.Lock()
+		if estimators, ok = t.pathEstimators[path]; !ok && len(t.pathEstimators) < maxTrackedPaths {
+			estimators = t.newEstimators()
+			t.pathEstimators[path] = estimators
+		}
+		t.pathMu.Unlock()
+	}
+	if estimators == nil {
+		path = OtherPath
+	} else {
+		estimators.record(rif, latency)
+	}
+
+	metrics.ObserveRequestLatency(path, latency)
+}
+
+// metricPath returns the metric label of path: the path itself if it is
+// tracked or has a configured priority, OtherPath otherwise
+func (t *Tracker) metricPath(path string) string {
+	if _, ok := t.admission.Priorities[path]; ok {
+		return path
+	}
+	t.pathMu.RLock()
+	defer t.pathMu.RUnlock()
+	if _, ok := t.pathEstimators[path]; ok {
+		return path
+	}
+	return OtherPath
+}
+
+// admissionEstimate returns the latency estimated for admitting a request
+// to path at the given RIF, falling back to the server-wide estimate for
+// untracked paths
+func (t *Tracker) admissionEstimate(path string, rif uint64) time.Duration {
+	t.pathMu.RLock()
+	estimators, ok := t.pathEstimators[path]
+	t.pathMu.RUnlock()
+	if !ok {
+		estimators = &t.estimators
+	}
+	return estimators.admission.Estimate(rif)
+}
+
+func (t *Tracker) incrementRIF() uint64 {
+	return atomic.AddUint64(&t.rif, 1)
+}
+
+func (t *Tracker) decrementRIF() uint64 {
+	return atomic.AddUint64(&t.rif, ^uint64(0))
+}
+
+// RIF returns the current number of requests in flight
+func (t *Tracker) RIF() uint64 {
+	return atomic.LoadUint64(&t.rif)
+}
+
+// drainPollInterval is how often WaitIdle checks the RIF
+const drainPollInterval = 10 * time.Millisecond
+
+// Drain marks the replica as draining. Probes report it, so Prequal clients
+// stop selecting the replica while it keeps serving the requests they
+// already sent.
+func (t *Tracker) Drain() {
+	t.draining.Store(true)
+}
+
+// Draining reports whether Drain was called
+func (t *Tracker) Draining() bool {
+	return t.draining.Load()
+}
+
+// WaitIdle blocks until no request is in flight or ctx is done
+func (t *Tracker) WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for t.RIF() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Probe returns the current RIF and the latency estimated for it, overall
+// and for each path, since paths can differ in latency by orders of
+// magnitude
+func (t *Tracker) Probe() ProbeResponse {
+	currentRIF := t.RIF()
+	medianLatency := t.estimators.probe.Estimate(currentRIF)
+	metrics.UpdateMedianLatency(medianLatency)
+
+	t.pathMu.RLock()
+	defer t.pathMu.RUnlock()
+	var pathLatencies map[string]time.Duration
+	if len(t.pathEstimators) > 0 {
+		pathLatencies = make(map[string]time.Duration, len(t.pathEstimators))
+		for path, estimators := range t.pathEstimators {
+			pathLatencies[path] = estimators.probe.Estimate(currentRIF)
+		}
+	}
+
+	return ProbeResponse{
+		RIF:           currentRIF,
+		MedianLatency: medianLatency,
+		PathLatencies: pathLatencies,
+		Draining:      t.Draining(),
+	}
+}
+
+// HandleProbe answers probe requests with the JSON encoded ProbeResponse
+func (t *Tracker) HandleProbe(w http.ResponseWriter, r *http.Request) {
+	NewProbeHandler(t).ServeHTTP(w, r)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddlewareTracksRIF(t *testing.T) {
+	tracker := NewTracker()
+	var inFlight uint64
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight = tracker.RIF()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	if inFlight != 1 {
+		t.Errorf("Expected RIF 1 while handling, got %d", inFlight)
+	}
+	if rif := tracker.RIF(); rif != 0 {
+		t.Errorf("Expected RIF 0 after handling, got %d", rif)
+	}
+	if _, ok := tracker.Probe().PathLatencies["/ping"]; !ok {
+		t.Errorf("Expected latency recorded for /ping")
+	}
+}
+
+func TestMiddlewarePathMapping(t *testing.T) {
+	tracker := NewTracker()
+	tracker.Path = func(r *http.Request) string { return "/users/{id}" }
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d", i), nil))
+	}
+
+	latencies := tracker.Probe().PathLatencies
+	if _, ok := latencies["/users/{id}"]; !ok || len(latencies) != 1 {
+		t.Errorf("Expected only /users/{id} to be tracked, got %v", latencies)
+	}
+}
+
+func TestTrackerBoundsPaths(t *testing.T) {
+	tracker := NewTracker()
+	for i := 0; i < 2*maxTrackedPaths; i++ {
+		tracker.recordLatency(fmt.Sprintf("/path/%d", i), 1, 1)
+	}
+
+	if n := len(tracker.Probe().PathLatencies); n != maxTrackedPaths {
+		t.Errorf("Expected %d tracked paths, got %d", maxTrackedPaths, n)
+	}
+	if label := tracker.metricPath("/path/0"); label != "/path/0" {
+		t.Errorf("Expected a tracked path to label its metrics, got %q", label)
+	}
+	if label := tracker.metricPath(fmt.Sprintf("/path/%d", maxTrackedPaths)); label != OtherPath {
+		t.Errorf("Expected an untracked path to be labelled %q, got %q", OtherPath, label)
+	}
+}
+
+func TestTrackerHandleProbe(t *testing.T) {
+	tracker := NewTracker()
+	tracker.recordLatency("/ping", 0, 5)
+
+	rec := httptest.NewRecorder()
+	tracker.HandleProbe(rec, httptest.NewRequest(http.MethodGet, "/probe", nil))
+
+	var probe ProbeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&probe); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if probe.PathLatencies["/ping"] != 5 {
+		t.Errorf("Expected /ping latency 5ns, got %v", probe.PathLatencies["/ping"])
+	}
+}